@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// auditValue is the value of a key before and after a change, null when absent
+type auditValue struct {
+	Old *string `json:"old"`
+	New *string `json:"new"`
+}
+
+// auditActor identifies who made a change
+type auditActor struct {
+	Context      string `json:"context,omitempty"`
+	Server       string `json:"server"`
+	User         string `json:"user,omitempty"`
+	FieldManager string `json:"fieldManager"`
+}
+
+// auditEntry is the --audit-log line of a secret created or patched
+type auditEntry struct {
+	Time        time.Time             `json:"time"`
+	Action      string                `json:"action"`
+	Namespace   string                `json:"namespace"`
+	Name        string                `json:"name"`
+	Annotations map[string]auditValue `json:"annotations,omitempty"`
+	Labels      map[string]auditValue `json:"labels,omitempty"`
+	// Data are the changed data keys, their values are never logged
+	Data  []string   `json:"data,omitempty"`
+	Actor auditActor `json:"actor"`
+}
+
+// currentActor returns the identity the tool writes to the managed cluster as
+func currentActor(cfg *config) auditActor {
+	return auditActor{
+		Context:      clusterContext,
+		Server:       clusterServer,
+		User:         clusterUser,
+		FieldManager: cfg.FieldManager,
+	}
+}
+
+// auditValues returns the old and new value of each changed and removed key
+func auditValues(old, new map[string]string, changed, removed []string) map[string]auditValue {
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+	lookup := func(m map[string]string, k string) *string {
+		if v, ok := m[k]; ok {
+			return &v
+		}
+		return nil
+	}
+	values := make(map[string]auditValue, len(changed)+len(removed))
+	for _, k := range changed {
+		values[k] = auditValue{Old: lookup(old, k), New: lookup(new, k)}
+	}
+	for _, k := range removed {
+		values[k] = auditValue{Old: lookup(old, k)}
+	}
+	return values
+}
+
+// auditEntries returns an entry per secret the results record as created or patched, with
+// the values of the changed keys taken from the existing secrets and the sent secrets
+func auditEntries(results []secrettemplate.Result, secrets []*corev1.Secret, existing []corev1.Secret, actor auditActor) []auditEntry {
+	sent := make(map[string]*corev1.Secret, len(secrets))
+	for _, s := range secrets {
+		sent[s.Namespace+"/"+s.Name] = s
+	}
+	live := make(map[string]*corev1.Secret, len(existing))
+	for i := range existing {
+		live[existing[i].Namespace+"/"+existing[i].Name] = &existing[i]
+	}
+	now := time.Now().UTC()
+	var entries []auditEntry
+	for _, r := range results {
+		if r.Change == nil || (r.Action != secrettemplate.ActionPatched && r.Action != secrettemplate.ActionCreated) {
+			continue
+		}
+		key := r.Namespace + "/" + r.Name
+		var oldA, oldL, newA, newL map[string]string
+		if s, ok := live[key]; ok {
+			oldA, oldL = s.Annotations, s.Labels
+		}
+		if s, ok := sent[key]; ok {
+			newA, newL = s.Annotations, s.Labels
+		}
+		entries = append(entries, auditEntry{
+			Time:        now,
+			Action:      r.Action,
+			Namespace:   r.Namespace,
+			Name:        r.Name,
+			Annotations: auditValues(oldA, newA, r.Change.Annotations, r.Change.RemoveAnnotations),
+			Labels:      auditValues(oldL, newL, r.Change.Labels, r.Change.RemoveLabels),
+			Data:        r.Change.Data,
+			Actor:       actor,
+		})
+	}
+	return entries
+}
+
+// writeAuditLog appends the entries to the audit log at path as JSON lines. With a
+// positive maxSize, a log which has reached it is first rotated to path.1, replacing any
+// previous rotated log.
+func writeAuditLog(path string, maxSize int64, entries []auditEntry) error {
+	l := log.WithFields(log.Fields{
+		"action":  "writeAuditLog",
+		"path":    path,
+		"entries": len(entries),
+	})
+	if len(entries) == 0 {
+		return nil
+	}
+	if fi, err := os.Stat(path); err == nil && maxSize > 0 && fi.Size() >= maxSize {
+		l.Printf("rotate audit log of %d bytes", fi.Size())
+		if err := os.Rename(path, path+".1"); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	l.Print("writeAuditLog")
+	return f.Close()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// strPtr returns a pointer to the string
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestAuditEntries(t *testing.T) {
+	existing := []corev1.Secret{{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "app",
+		Annotations: map[string]string{"owner": "team-a", "stale": "true"},
+		Labels:      map[string]string{"tier": "web"},
+	}}}
+	sent := []*corev1.Secret{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", Annotations: map[string]string{"owner": "team-b", "new": "x"}, Labels: map[string]string{"tier": "web"}}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db", Labels: map[string]string{"tier": "db"}}},
+	}
+	results := []secrettemplate.Result{
+		{Namespace: "default", Name: "app", Action: secrettemplate.ActionPatched, Change: &secrettemplate.Change{
+			Annotations:       []string{"new", "owner"},
+			RemoveAnnotations: []string{"stale"},
+			Data:              []string{"password"},
+		}},
+		{Namespace: "default", Name: "db", Action: secrettemplate.ActionCreated, Change: &secrettemplate.Change{Labels: []string{"tier"}, Create: true}},
+		{Namespace: "default", Name: "skipped", Action: secrettemplate.ActionSkipped, Change: &secrettemplate.Change{Labels: []string{"tier"}}},
+		{Namespace: "default", Name: "failed", Action: secrettemplate.ActionError, Change: &secrettemplate.Change{Labels: []string{"tier"}}, Error: "boom"},
+		{Namespace: "default", Name: "unchanged", Action: secrettemplate.ActionPatched},
+	}
+	actor := auditActor{Context: "prod", Server: "https://k8s", User: "admin", FieldManager: "k8s-secret-template"}
+	entries := auditEntries(results, sent, existing, actor)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(entries), entries)
+	}
+	tests := []struct {
+		name        string
+		entry       auditEntry
+		action      string
+		annotations map[string]auditValue
+		labels      map[string]auditValue
+		data        []string
+	}{
+		{
+			name:   "patched",
+			entry:  entries[0],
+			action: secrettemplate.ActionPatched,
+			annotations: map[string]auditValue{
+				"owner": {Old: strPtr("team-a"), New: strPtr("team-b")},
+				"new":   {New: strPtr("x")},
+				"stale": {Old: strPtr("true")},
+			},
+			data: []string{"password"},
+		},
+		{
+			name:   "created",
+			entry:  entries[1],
+			action: secrettemplate.ActionCreated,
+			labels: map[string]auditValue{"tier": {New: strPtr("db")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.entry.Action != tt.action {
+				t.Errorf("action = %s, want %s", tt.entry.Action, tt.action)
+			}
+			if !reflect.DeepEqual(tt.entry.Annotations, tt.annotations) {
+				t.Errorf("annotations = %v, want %v", tt.entry.Annotations, tt.annotations)
+			}
+			if !reflect.DeepEqual(tt.entry.Labels, tt.labels) {
+				t.Errorf("labels = %v, want %v", tt.entry.Labels, tt.labels)
+			}
+			if !reflect.DeepEqual(tt.entry.Data, tt.data) {
+				t.Errorf("data = %v, want %v", tt.entry.Data, tt.data)
+			}
+			if tt.entry.Actor != actor {
+				t.Errorf("actor = %+v, want %+v", tt.entry.Actor, actor)
+			}
+		})
+	}
+}
+
+// auditLines returns the entries of the audit log at path, none if it does not exist
+func auditLines(t *testing.T, path string) []auditEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []auditEntry
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e auditEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatalf("invalid audit line %q: %v", s.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestWriteAuditLog(t *testing.T) {
+	entry := func(name string) auditEntry {
+		return auditEntry{Action: secrettemplate.ActionPatched, Namespace: "default", Name: name}
+	}
+	tests := []struct {
+		name        string
+		maxSize     int64
+		writes      [][]auditEntry
+		wantCurrent []string
+		wantRotated []string
+	}{
+		{
+			name:        "appends without a size limit",
+			writes:      [][]auditEntry{{entry("a")}, {entry("b"), entry("c")}},
+			wantCurrent: []string{"a", "b", "c"},
+		},
+		{
+			name:        "no entries writes nothing",
+			writes:      [][]auditEntry{nil},
+			wantCurrent: nil,
+		},
+		{
+			name:        "below the limit appends",
+			maxSize:     1 << 20,
+			writes:      [][]auditEntry{{entry("a")}, {entry("b")}},
+			wantCurrent: []string{"a", "b"},
+		},
+		{
+			name:        "rotates once the limit is reached",
+			maxSize:     1,
+			writes:      [][]auditEntry{{entry("a")}, {entry("b")}},
+			wantCurrent: []string{"b"},
+			wantRotated: []string{"a"},
+		},
+		{
+			name:        "replaces the previous rotated log",
+			maxSize:     1,
+			writes:      [][]auditEntry{{entry("a")}, {entry("b")}, {entry("c")}},
+			wantCurrent: []string{"c"},
+			wantRotated: []string{"b"},
+		},
+	}
+	names := func(entries []auditEntry) []string {
+		var n []string
+		for _, e := range entries {
+			n = append(n, e.Name)
+		}
+		return n
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			for _, w := range tt.writes {
+				if err := writeAuditLog(path, tt.maxSize, w); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := names(auditLines(t, path)); !reflect.DeepEqual(got, tt.wantCurrent) {
+				t.Errorf("audit log = %v, want %v", got, tt.wantCurrent)
+			}
+			if got := names(auditLines(t, path+".1")); !reflect.DeepEqual(got, tt.wantRotated) {
+				t.Errorf("rotated audit log = %v, want %v", got, tt.wantRotated)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// configureExecProvider prepares an exec credential plugin (e.g. aws eks get-token or
+// gke-gcloud-auth-plugin) configured in the kubeconfig. Each passEnv entry is either
+// NAME=VALUE or NAME, in which case the value is taken from the current environment.
+// An error is returned if the plugin binary cannot be found, rather than letting the
+// first API call fail with an opaque authentication error.
+func configureExecProvider(config *rest.Config, passEnv []string) error {
+	ep := config.ExecProvider
+	if ep == nil {
+		return nil
+	}
+	if _, err := exec.LookPath(ep.Command); err != nil {
+		hint := ep.InstallHint
+		if hint == "" {
+			hint = "install it or update the exec command of the kubeconfig user"
+		}
+		return fmt.Errorf("exec credential plugin %q not found: %v: %s", ep.Command, err, hint)
+	}
+	for _, e := range passEnv {
+		name, value := e, ""
+		if i := strings.Index(e, "="); i >= 0 {
+			name, value = e[:i], e[i+1:]
+		} else {
+			value = os.Getenv(name)
+		}
+		ep.Env = append(ep.Env, clientcmdapi.ExecEnvVar{
+			Name:  name,
+			Value: value,
+		})
+	}
+	return nil
+}
+
+// kubeconfigFromSecret builds the config of a target cluster from the kubeconfig stored
+// under key in the secret referenced by ref (namespace/name), read using the host config,
+// along with the current context and its cluster name
+func kubeconfigFromSecret(ctx context.Context, host *rest.Config, ref string, key string) (*rest.Config, string, string, error) {
+	ns, name, err := splitNamespacedName(ref)
+	if err != nil {
+		return nil, "", "", err
+	}
+	hc, err := kubernetes.NewForConfig(host)
+	if err != nil {
+		return nil, "", "", err
+	}
+	s, err := hc.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, "", "", fmt.Errorf("kubeconfig secret %s not found", ref)
+	} else if err != nil {
+		return nil, "", "", fmt.Errorf("kubeconfig secret %s: %w", ref, err)
+	}
+	kc, ok := s.Data[key]
+	if !ok || len(kc) == 0 {
+		return nil, "", "", fmt.Errorf("kubeconfig secret %s has no %q key", ref, key)
+	}
+	raw, err := clientcmd.Load(kc)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("kubeconfig secret %s key %q: %w", ref, key, err)
+	}
+	config, err := clientcmd.NewDefaultClientConfig(*raw, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, "", "", fmt.Errorf("kubeconfig secret %s key %q: %w", ref, key, err)
+	}
+	return config, raw.CurrentContext, contextCluster(*raw, ""), nil
+}
+
+// contextCluster returns the cluster name of the named kubeconfig context, or of the
+// current context when name is empty
+func contextCluster(raw clientcmdapi.Config, name string) string {
+	if name == "" {
+		name = raw.CurrentContext
+	}
+	if c, ok := raw.Contexts[name]; ok {
+		return c.Cluster
+	}
+	return ""
+}
+
+// checkExpectedCluster returns an error unless expect is the API server URL or the
+// kubeconfig cluster name of the managed cluster. An empty expect matches any cluster.
+func checkExpectedCluster(expect string) error {
+	if expect == "" {
+		return nil
+	}
+	if strings.TrimSuffix(expect, "/") == strings.TrimSuffix(clusterServer, "/") {
+		return nil
+	}
+	if clusterName != "" && expect == clusterName {
+		return nil
+	}
+	name := clusterName
+	if name == "" {
+		name = "-"
+	}
+	return fmt.Errorf("--expect-cluster %s does not match the resolved cluster, server %s name %s", expect, clusterServer, name)
+}
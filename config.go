@@ -0,0 +1,626 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	"sigs.k8s.io/yaml"
+)
+
+// duration is a time.Duration which is set and serialized in its string form (e.g. "24h")
+type duration struct {
+	time.Duration
+}
+
+// Set parses a duration string, implementing flag.Value
+func (d *duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// MarshalJSON renders the duration as a string
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON parses a duration string
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.Set(s)
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+// String joins the values with commas, implementing flag.Value
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set appends a value, implementing flag.Value
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// reset clears the values so a higher precedence source replaces rather than extends them
+func (s *stringList) reset() {
+	*s = nil
+}
+
+// resetter is implemented by flag values that accumulate across Set calls
+type resetter interface {
+	reset()
+}
+
+// config holds the options resolved from the command line and environment
+type config struct {
+	SecretsDir               string     `json:"secretsDir"`
+	MaxChanges               int        `json:"maxChanges"`
+	DefaultNamespace         string     `json:"defaultNamespace"`
+	Quiet                    bool       `json:"quiet"`
+	RespectForeign           bool       `json:"respectForeign"`
+	EnableInclude            bool       `json:"enableInclude"`
+	Since                    duration   `json:"since"`
+	StatusConfigMap          string     `json:"statusConfigMap"`
+	IncludeData              bool       `json:"includeData"`
+	DryRun                   bool       `json:"dryRun"`
+	Output                   string     `json:"output"`
+	DetailedExitCode         bool       `json:"detailedExitCode"`
+	Interval                 duration   `json:"interval"`
+	Jitter                   float64    `json:"jitter"`
+	MaxBackoff               duration   `json:"maxBackoff"`
+	ExecEnv                  stringList `json:"execEnv"`
+	RunTimeout               duration   `json:"runTimeout"`
+	KubeconfigFromSecret     string     `json:"kubeconfigFromSecret"`
+	KubeconfigSecretKey      string     `json:"kubeconfigSecretKey"`
+	NotifyWebhook            string     `json:"notifyWebhook"`
+	NotifyOn                 string     `json:"notifyOn"`
+	Replace                  bool       `json:"replace"`
+	ManagementPrefix         string     `json:"managementPrefix"`
+	DumpEffectiveSecrets     bool       `json:"dumpEffectiveSecrets"`
+	ShowData                 bool       `json:"showData"`
+	Concurrency              int        `json:"concurrency"`
+	OnlyChanged              bool       `json:"onlyChanged"`
+	Incremental              bool       `json:"incremental"`
+	FullSyncInterval         duration   `json:"fullSyncInterval"`
+	CreateMissing            bool       `json:"createMissing"`
+	IgnoreFile               string     `json:"ignoreFile"`
+	EnableTemplating         bool       `json:"enableTemplating"`
+	StrictDecode             bool       `json:"strictDecode"`
+	Verify                   bool       `json:"verify"`
+	WatchSecrets             bool       `json:"watchSecrets"`
+	OnlyIfMissing            string     `json:"onlyIfMissing"`
+	MergeStrategy            string     `json:"mergeStrategy"`
+	Values                   stringList `json:"values"`
+	MetricsAddr              string     `json:"metricsAddr"`
+	ReconcileOnce            bool       `json:"reconcileOnce"`
+	MetricsLinger            duration   `json:"metricsLinger"`
+	Pushgateway              string     `json:"pushgateway"`
+	PushgatewayJob           string     `json:"pushgatewayJob"`
+	IgnoreCase               bool       `json:"ignoreCase"`
+	LogFormat                string     `json:"logFormat"`
+	LogCaller                bool       `json:"logCaller"`
+	NameAllNamespaces        bool       `json:"nameAllNamespaces"`
+	Transactional            bool       `json:"transactional"`
+	Env                      string     `json:"env"`
+	Kustomize                string     `json:"kustomize"`
+	NamespaceSource          string     `json:"namespaceSource"`
+	NamespaceSelector        string     `json:"namespaceSelector"`
+	RBACServiceAccount       string     `json:"rbacServiceAccount"`
+	WaitForSecret            duration   `json:"waitForSecret"`
+	DiffContext              int        `json:"diffContext"`
+	ShowUnchanged            bool       `json:"showUnchanged"`
+	Atomic                   bool       `json:"atomic"`
+	StrictMetadata           bool       `json:"strictMetadata"`
+	Report                   string     `json:"report"`
+	ReportFormat             string     `json:"reportFormat"`
+	SummaryOnly              bool       `json:"summaryOnly"`
+	ListConcurrency          int        `json:"listConcurrency"`
+	PatchConcurrency         int        `json:"patchConcurrency"`
+	OnOverlap                string     `json:"onOverlap"`
+	NamePrefix               string     `json:"namePrefix"`
+	NameSuffix               string     `json:"nameSuffix"`
+	WritePlan                string     `json:"writePlan"`
+	ApplyPlan                string     `json:"applyPlan"`
+	Context                  string     `json:"context"`
+	NamespaceRegex           string     `json:"namespaceRegex"`
+	NamespaceMatch           string     `json:"namespaceMatch"`
+	StrictOwnership          bool       `json:"strictOwnership"`
+	AnnotationsFile          string     `json:"annotationsFile"`
+	DryRunServer             bool       `json:"dryRunServer"`
+	NeverRemove              stringList `json:"neverRemove"`
+	FieldManager             string     `json:"fieldManager"`
+	ServerSide               bool       `json:"serverSide"`
+	ForceConflicts           bool       `json:"forceConflicts"`
+	LabelMappings            string     `json:"labelMappings"`
+	WatchConfig              bool       `json:"watchConfig"`
+	IncludeEmptyNamespaces   bool       `json:"includeEmptyNamespaces"`
+	ExpectCluster            string     `json:"expectCluster"`
+	ReplicateTo              stringList `json:"replicateTo"`
+	BatchSize                int        `json:"batchSize"`
+	BatchPause               duration   `json:"batchPause"`
+	ContextNamespaceOverride string     `json:"contextNamespaceOverride"`
+	PostRenderer             string     `json:"postRenderer"`
+	ListManaged              bool       `json:"-"`
+	ListAnnotations          stringList `json:"listAnnotations"`
+	AnnotationMergeSeparator string     `json:"annotationMergeSeparator"`
+	SinceLastRun             string     `json:"sinceLastRun"`
+	NewestOnly               bool       `json:"newestOnly"`
+	AuditLog                 string     `json:"auditLog"`
+	AuditLogMaxSize          int64      `json:"auditLogMaxSize"`
+	GracefulDegrade          bool       `json:"gracefulDegrade"`
+	FailureThreshold         int        `json:"failureThreshold"`
+	Force                    bool       `json:"force"`
+	CopyDataNamespaces       stringList `json:"copyDataNamespaces"`
+	ReconcileNamespaceSerial bool       `json:"reconcileNamespaceSerial"`
+	NamespacePause           duration   `json:"namespacePause"`
+	BetweenNamespaceCheck    string     `json:"betweenNamespaceCheck"`
+	Checksum                 bool       `json:"checksum"`
+	ConfigFile               string     `json:"-"`
+	PrintConfig              bool       `json:"-"`
+	PrintRBAC                bool       `json:"-"`
+	// ignored is loaded from IgnoreFile once at startup
+	ignored ignoreList
+	// values are loaded from the Values files once at startup
+	values map[string]interface{}
+	// annotations are loaded from AnnotationsFile once at startup
+	annotations map[string]map[string]string
+	// labelMappings are loaded from LabelMappings once at startup
+	labelMappings []secrettemplate.LabelMapping
+	// contextNamespaces are loaded from ContextNamespaceOverride once at startup
+	contextNamespaces map[string]map[string]string
+	// secretPaths are the positional template files and directories, SecretsDir being the first
+	secretPaths []string
+}
+
+// envPrefix is prepended to the upper-cased flag name to form its environment variable
+const envPrefix = "K8S_SECRET_TEMPLATE_"
+
+// newFlagSet returns a FlagSet bound to the fields of c, setting c to the defaults
+func newFlagSet(c *config) *flag.FlagSet {
+	fs := flag.NewFlagSet("k8s-secret-template", flag.ContinueOnError)
+	fs.StringVar(&c.ConfigFile, "config", "", "path to a YAML configuration file")
+	fs.IntVar(&c.MaxChanges, "max-changes", -1, "abort before patching if more than this many secrets would change (-1 for unlimited)")
+	fs.StringVar(&c.DefaultNamespace, "default-namespace", "", "namespace for templates that omit one (defaults to the in-cluster namespace)")
+	fs.BoolVar(&c.Quiet, "quiet", false, "only log errors and print a one-line summary")
+	fs.BoolVar(&c.RespectForeign, "respect-foreign", false, "skip secrets that are owned or managed by another controller instead of warning")
+	fs.BoolVar(&c.EnableInclude, "enable-include", false, "resolve \"!include path\" directives in template files")
+	fs.Var(&c.Since, "since", "only update existing secrets created within this duration (e.g. 24h)")
+	fs.StringVar(&c.StatusConfigMap, "status-configmap", "", "namespace/name of a ConfigMap to write the run summary to")
+	fs.BoolVar(&c.IncludeData, "include-data", false, "also patch the template's data and stringData into existing secrets")
+	fs.BoolVar(&c.DryRun, "dry-run", false, "print the changes that would be made without patching")
+	fs.StringVar(&c.Output, "output", "table", "dry run output format: table, yaml, json or diff")
+	fs.BoolVar(&c.DetailedExitCode, "detailed-exitcode", false, "with --dry-run, exit 2 when changes would be made")
+	fs.Var(&c.Interval, "interval", "run continuously, reconciling at this interval (e.g. 5m)")
+	fs.Float64Var(&c.Jitter, "jitter", 0.1, "randomize each interval by up to this fraction of it (0 for a fixed interval)")
+	c.MaxBackoff = duration{30 * time.Minute}
+	fs.Var(&c.MaxBackoff, "max-backoff", "cap on the exponential backoff applied to the interval after failed reconciles")
+	fs.Var(&c.ExecEnv, "exec-env", "NAME or NAME=VALUE environment variable to pass to the kubeconfig exec credential plugin (repeatable)")
+	fs.Var(&c.RunTimeout, "run-timeout", "abort the whole run, cancelling in-flight requests, after this duration")
+	fs.StringVar(&c.KubeconfigFromSecret, "kubeconfig-from-secret", "", "namespace/name of a secret holding the kubeconfig of the cluster to manage")
+	fs.StringVar(&c.KubeconfigSecretKey, "kubeconfig-secret-key", "kubeconfig", "data key of the kubeconfig in --kubeconfig-from-secret")
+	fs.StringVar(&c.NotifyWebhook, "notify-webhook", "", "URL to POST a JSON run summary to, e.g. a Slack incoming webhook")
+	fs.StringVar(&c.NotifyOn, "notify-on", "change", "when to notify the webhook: change, error or always")
+	fs.BoolVar(&c.Replace, "replace", false, "remove annotations and labels under --management-prefix that the template no longer defines")
+	fs.StringVar(&c.ManagementPrefix, "management-prefix", "k8s-secret-template/", "key prefix of the annotations and labels owned by the tool in --replace mode")
+	fs.BoolVar(&c.DumpEffectiveSecrets, "dump-effective-secrets", false, "print the merged secrets as YAML instead of patching")
+	fs.BoolVar(&c.ShowData, "show-data", false, "include secret data in --dump-effective-secrets output")
+	fs.IntVar(&c.Concurrency, "concurrency", 4, "maximum number of namespaces to list and patch in parallel")
+	fs.BoolVar(&c.OnlyChanged, "only-changed", false, "only print the secrets that changed, printing nothing on a no-op run")
+	fs.BoolVar(&c.Incremental, "incremental", false, "in daemon mode, only reconcile secrets changed since the last seen resourceVersion between full syncs")
+	c.FullSyncInterval = duration{time.Hour}
+	fs.Var(&c.FullSyncInterval, "full-sync-interval", "with --incremental, how often to list every secret instead of watching for changes")
+	fs.BoolVar(&c.CreateMissing, "create-missing", false, "create secrets from templates when no secret of the same name exists")
+	fs.StringVar(&c.IgnoreFile, "ignore-file", "", "path to a file of namespace/name globs of secrets to never touch")
+	fs.BoolVar(&c.EnableTemplating, "enable-templating", false, "render annotation and label values as Go templates against the matched secret")
+	fs.BoolVar(&c.StrictDecode, "strict-decode", false, "reject secret templates with unknown or duplicate fields")
+	fs.BoolVar(&c.Verify, "verify", false, "read each changed secret back and fail if its annotations and labels were not applied")
+	fs.BoolVar(&c.WatchSecrets, "watch-secrets", false, "run continuously, reconciling secrets as they are created or updated")
+	fs.StringVar(&c.OnlyIfMissing, "only-if-missing", "", "only update existing secrets which do not yet have this annotation key")
+	fs.StringVar(&c.MergeStrategy, "merge-strategy", "replace", "how annotation values set on both the template and the secret merge: replace or deep")
+	fs.Var(&c.Values, "values", "YAML file of values available to value templates as .Values (repeatable, later files override earlier ones)")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", "", "address to serve Prometheus metrics on at /metrics in daemon and --reconcile-once modes, e.g. :9090")
+	fs.BoolVar(&c.ReconcileOnce, "reconcile-once", false, "run a single reconcile with the daemon machinery, metrics and signal handling, then exit")
+	c.MetricsLinger = duration{30 * time.Second}
+	fs.Var(&c.MetricsLinger, "metrics-linger", "with --reconcile-once and --metrics-addr, how long to keep serving metrics before exiting")
+	fs.StringVar(&c.Pushgateway, "pushgateway", "", "URL of a Prometheus Pushgateway to push the metrics of one-shot and --reconcile-once runs to")
+	fs.StringVar(&c.PushgatewayJob, "pushgateway-job", "k8s-secret-template", "job label of the metrics pushed to --pushgateway")
+	fs.BoolVar(&c.IgnoreCase, "ignore-case", false, "match templates to existing secrets whose name differs only in case")
+	fs.StringVar(&c.LogFormat, "log-format", "text", "log format: text or json")
+	fs.BoolVar(&c.LogCaller, "log-caller", false, "include the file:line of the logging call in each log entry")
+	fs.BoolVar(&c.NameAllNamespaces, "name-all-namespaces", false, "apply templates without a namespace to the secret of that name in every namespace")
+	fs.BoolVar(&c.Transactional, "transactional", false, "verify each patched secret and revert it to its pre-patch metadata if the change did not stick")
+	fs.StringVar(&c.Env, "env", "", "merge the templates of base/ with those of overlays/<env>/ in the secrets directory")
+	fs.StringVar(&c.Kustomize, "kustomize", "", "directory of a kustomization whose rendered Secrets are used as the templates instead of the secrets directory")
+	fs.StringVar(&c.NamespaceSource, "namespace-source", "templates", "where the namespaces to reconcile come from: templates, all or selector")
+	fs.StringVar(&c.NamespaceSelector, "namespace-selector", "", "label selector of the namespaces to reconcile with --namespace-source=selector")
+	fs.StringVar(&c.RBACServiceAccount, "rbac-service-account", "default/k8s-secret-template", "namespace/name of the service account bound by --print-rbac")
+	fs.Var(&c.WaitForSecret, "wait-for-secret", "wait up to this duration for the secrets of name matched templates to exist before applying")
+	fs.IntVar(&c.DiffContext, "diff-context", 0, "with --output=diff, the number of unchanged keys shown around each changed key")
+	fs.BoolVar(&c.ShowUnchanged, "show-unchanged", false, "with --output=diff, show every unchanged key")
+	fs.BoolVar(&c.Atomic, "atomic", false, "validate every change with a server-side dry run first and change nothing unless all of them pass")
+	fs.BoolVar(&c.StrictMetadata, "strict-metadata", false, "fail on annotations and labels the API server would reject instead of skipping them")
+	fs.StringVar(&c.Report, "report", "", "path to write a report of the run to, in --report-format")
+	fs.StringVar(&c.ReportFormat, "report-format", "junit", "format of the --report: junit")
+	fs.BoolVar(&c.SummaryOnly, "summary-only", false, "print the run summary as a single line JSON object to stdout")
+	fs.IntVar(&c.ListConcurrency, "list-concurrency", 0, "maximum number of namespaces to list in parallel, defaulting to --concurrency")
+	fs.IntVar(&c.PatchConcurrency, "patch-concurrency", 0, "maximum number of namespaces to patch in parallel, defaulting to --concurrency")
+	fs.StringVar(&c.OnOverlap, "on-overlap", "merge", "how a secret matched by several templates is reported: merge, warn or error")
+	fs.StringVar(&c.NamePrefix, "name-prefix", "", "prefix added to the names of the templates matching by name")
+	fs.StringVar(&c.NameSuffix, "name-suffix", "", "suffix added to the names of the templates matching by name")
+	fs.StringVar(&c.WritePlan, "write-plan", "", "compute the changes and write them to a plan file for --apply-plan instead of patching")
+	fs.StringVar(&c.ApplyPlan, "apply-plan", "", "create and patch exactly the secrets of a --write-plan file, without reading the templates")
+	fs.StringVar(&c.Context, "context", "", "kubeconfig context to use, defaulting to $KUBE_CONTEXT and then the current context")
+	fs.StringVar(&c.NamespaceRegex, "namespace-regex", "", "with --namespace-source=selector, regular expression namespace names must match")
+	fs.StringVar(&c.NamespaceMatch, "namespace-match", "and", "with both --namespace-selector and --namespace-regex, whether namespaces must match both (and) or either (or)")
+	fs.BoolVar(&c.StrictOwnership, "strict-ownership", false, "fail instead of warning when changing keys another field manager owns through server-side apply")
+	fs.StringVar(&c.AnnotationsFile, "annotations-file", "", "JSON file mapping namespace/name of secrets to extra annotations merged over the template annotations")
+	fs.BoolVar(&c.DryRunServer, "dry-run-server", false, "send every create and patch as a server-side dry run, reporting admission and validation errors without changing any secret")
+	fs.Var(&c.NeverRemove, "never-remove", "annotation or label key --replace never removes, even when the template no longer defines it (repeatable)")
+	fs.StringVar(&c.FieldManager, "field-manager", secrettemplate.FieldManager, "field manager name secrets are created and patched as")
+	fs.BoolVar(&c.ServerSide, "server-side", false, "patch secrets with server-side apply instead of a JSON merge patch")
+	fs.BoolVar(&c.ForceConflicts, "force-conflicts", false, "with --server-side, take over fields owned by another field manager instead of failing")
+	fs.StringVar(&c.LabelMappings, "label-mappings", "", "YAML file of mappings deriving annotations from the labels of matched secrets")
+	fs.BoolVar(&c.WatchConfig, "watch-config", false, "in daemon mode, reload the config file before each reconcile when it changes")
+	fs.BoolVar(&c.IncludeEmptyNamespaces, "include-empty-namespaces", false, "list the checked namespaces without any matched or created secret in the summary and report")
+	fs.StringVar(&c.ExpectCluster, "expect-cluster", "", "abort unless the API server URL or kubeconfig cluster name of the resolved cluster is this value")
+	fs.Var(&c.ReplicateTo, "replicate-to", "comma separated namespaces each template also applies to, besides its own (repeatable)")
+	fs.IntVar(&c.BatchSize, "batch-size", 0, "create or patch at most this many secrets before pausing for --batch-pause, 0 for no batching")
+	fs.Var(&c.BatchPause, "batch-pause", "pause between batches of --batch-size secrets")
+	fs.StringVar(&c.ContextNamespaceOverride, "context-namespace-override", "", "YAML file mapping kubeconfig contexts to the namespaces template namespaces are translated to in them")
+	fs.StringVar(&c.PostRenderer, "post-renderer", "", "command each template document is piped through before parsing, its stdout replacing the document")
+	fs.BoolVar(&c.ListManaged, "list-managed", false, "list the secrets of the template namespaces the tool manages and whether the templates would change them, then exit")
+	fs.Var(&c.ListAnnotations, "list-annotation", "annotation key, or key=separator, whose template and existing values are unioned as separated lists (repeatable)")
+	fs.StringVar(&c.AnnotationMergeSeparator, "annotation-merge-separator", ",", "separator of --list-annotation values without their own")
+	fs.StringVar(&c.SinceLastRun, "since-last-run", "", "file storing the last successful run, only secrets changed since are processed between full syncs")
+	fs.BoolVar(&c.NewestOnly, "newest-only", false, "apply each glob or selector template only to the newest of the secrets it matches in its namespace")
+	fs.StringVar(&c.AuditLog, "audit-log", "", "file a JSON line is appended to for every secret created or patched")
+	fs.Int64Var(&c.AuditLogMaxSize, "audit-log-max-size", 0, "rotate the --audit-log to <path>.1 once it reaches this many bytes, 0 to never rotate")
+	fs.BoolVar(&c.GracefulDegrade, "graceful-degrade", false, "in daemon mode, retry failures to reach the API server on the next interval and only fail readiness after --failure-threshold in a row")
+	fs.IntVar(&c.FailureThreshold, "failure-threshold", 3, "with --graceful-degrade, consecutive transient failures after which readiness fails")
+	fs.BoolVar(&c.Force, "force", false, "process every secret, bypassing the --since-last-run and --checksum shortcuts")
+	fs.Var(&c.CopyDataNamespaces, "copy-data-namespace", "namespace the copy-data directive may read source secrets from, with --include-data (repeatable)")
+	fs.BoolVar(&c.ReconcileNamespaceSerial, "reconcile-namespace-serial", false, "patch one namespace at a time, stopping before the next if one fails or --between-namespace-check does")
+	fs.Var(&c.NamespacePause, "namespace-pause", "with --reconcile-namespace-serial, pause after each changed namespace")
+	fs.StringVar(&c.BetweenNamespaceCheck, "between-namespace-check", "", "with --reconcile-namespace-serial, command run after each changed namespace with NAMESPACE set, whose failure stops the run")
+	fs.BoolVar(&c.Checksum, "checksum", false, "store the checksum of what the templates set on each secret and skip secrets already holding it")
+	fs.BoolVar(&c.PrintConfig, "print-config", false, "print the effective configuration and exit")
+	fs.BoolVar(&c.PrintRBAC, "print-rbac", false, "print the Role or ClusterRole and binding the configured mode needs and exit")
+	return fs
+}
+
+// envName returns the environment variable which sets the named flag
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadConfigFile reads the YAML configuration file at path into c, rejecting unknown keys
+func loadConfigFile(path string, c *config) error {
+	fd, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(fd, c); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// parseFlags resolves the config from defaults, the config file, the environment and
+// the command line arguments, in increasing order of precedence
+func parseFlags(args []string) (*config, error) {
+	// the first pass locates the config file and the flags set on the command line
+	pre := &config{}
+	pfs := newFlagSet(pre)
+	if err := pfs.Parse(args); err != nil {
+		return nil, err
+	}
+	explicit := map[string]bool{}
+	pfs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	configFile := pre.ConfigFile
+	if configFile == "" {
+		configFile = os.Getenv(envName("config"))
+	}
+	c := &config{}
+	fs := newFlagSet(c)
+	if configFile != "" {
+		if err := loadConfigFile(configFile, c); err != nil {
+			return nil, err
+		}
+	}
+	var eerr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if v, ok := os.LookupEnv(envName(f.Name)); ok && eerr == nil {
+			if r, ok := f.Value.(resetter); ok {
+				r.reset()
+			}
+			if err := f.Value.Set(v); err != nil {
+				eerr = fmt.Errorf("%s: %w", envName(f.Name), err)
+			}
+		}
+		if r, ok := f.Value.(resetter); ok && explicit[f.Name] {
+			r.reset()
+		}
+	})
+	if eerr != nil {
+		return nil, eerr
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	c.ConfigFile = configFile
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	if c.IgnoreFile != "" {
+		ignored, err := loadIgnoreFile(c.IgnoreFile)
+		if err != nil {
+			return nil, err
+		}
+		c.ignored = ignored
+	}
+	if len(c.Values) > 0 {
+		if !c.EnableTemplating {
+			return nil, fmt.Errorf("--values requires --enable-templating")
+		}
+		values, err := loadValuesFiles(c.Values)
+		if err != nil {
+			return nil, err
+		}
+		c.values = values
+	}
+	if c.AnnotationsFile != "" {
+		annotations, err := loadAnnotationsFile(c.AnnotationsFile)
+		if err != nil {
+			return nil, err
+		}
+		c.annotations = annotations
+	}
+	if c.LabelMappings != "" {
+		mappings, err := loadLabelMappings(c.LabelMappings)
+		if err != nil {
+			return nil, err
+		}
+		c.labelMappings = mappings
+	}
+	if c.ContextNamespaceOverride != "" {
+		namespaces, err := loadContextNamespaces(c.ContextNamespaceOverride)
+		if err != nil {
+			return nil, err
+		}
+		c.contextNamespaces = namespaces
+	}
+	if sd := os.Getenv("SECRETS_DIR"); sd != "" {
+		c.SecretsDir = sd
+	} else if fs.NArg() > 0 {
+		c.SecretsDir = fs.Arg(0)
+		c.secretPaths = fs.Args()
+	}
+	if len(c.secretPaths) > 1 && (c.Env != "" || c.Kustomize != "") {
+		return nil, fmt.Errorf("--env and --kustomize accept a single secrets directory, got %d paths", len(c.secretPaths))
+	}
+	return c, nil
+}
+
+// listConcurrency returns the number of namespaces listed in parallel, --concurrency
+// unless --list-concurrency is set
+func (c *config) listConcurrency() int {
+	if c.ListConcurrency > 0 {
+		return c.ListConcurrency
+	}
+	return c.Concurrency
+}
+
+// replicateNamespaces returns the namespaces of --replicate-to, each value listing them
+// separated by commas or whitespace
+func (c *config) replicateNamespaces() []string {
+	var namespaces []string
+	for _, v := range c.ReplicateTo {
+		namespaces = append(namespaces, strings.FieldsFunc(v, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\n'
+		})...)
+	}
+	return namespaces
+}
+
+// patchConcurrency returns the number of namespaces patched in parallel, --concurrency
+// unless --patch-concurrency is set
+func (c *config) patchConcurrency() int {
+	if c.PatchConcurrency > 0 {
+		return c.PatchConcurrency
+	}
+	return c.Concurrency
+}
+
+// listAnnotations returns the separator of each --list-annotation key, given as key or
+// key=separator, defaulting to --annotation-merge-separator
+func (c *config) listAnnotations() map[string]string {
+	if len(c.ListAnnotations) == 0 {
+		return nil
+	}
+	lists := make(map[string]string, len(c.ListAnnotations))
+	for _, v := range c.ListAnnotations {
+		key, sep := v, c.AnnotationMergeSeparator
+		if i := strings.Index(v, "="); i >= 0 {
+			key, sep = v[:i], v[i+1:]
+		}
+		lists[key] = sep
+	}
+	return lists
+}
+
+// mergeOptions returns the options templates are merged into existing secrets with
+func (c *config) mergeOptions() secrettemplate.MergeOptions {
+	return secrettemplate.MergeOptions{
+		IncludeData:      c.IncludeData,
+		Replace:          c.Replace,
+		ManagementPrefix: c.ManagementPrefix,
+		NeverRemove:      c.NeverRemove,
+		CreateMissing:    c.CreateMissing,
+		Templating:       c.EnableTemplating,
+		OnlyIfMissing:    c.OnlyIfMissing,
+		MergeStrategy:    c.MergeStrategy,
+		ListAnnotations:  c.listAnnotations(),
+		StrictMetadata:   c.StrictMetadata,
+		Annotations:      c.annotations,
+		LabelMappings:    c.labelMappings,
+		Values:           c.values,
+		Checksum:         c.Checksum,
+	}
+}
+
+// patchOptions returns the options secrets are created and patched with
+func (c *config) patchOptions() secrettemplate.PatchOptions {
+	opts := secrettemplate.PatchOptions{
+		IncludeData:     c.IncludeData,
+		Concurrency:     c.patchConcurrency(),
+		Verify:          c.Verify,
+		Transactional:   c.Transactional,
+		Atomic:          c.Atomic,
+		FieldManager:    c.FieldManager,
+		ServerSideApply: c.ServerSide,
+		ForceConflicts:  c.ForceConflicts,
+		BatchSize:       c.BatchSize,
+		BatchPause:      c.BatchPause.Duration,
+	}
+	if c.ReconcileNamespaceSerial {
+		opts.SerialNamespaces, opts.NamespacePause = true, c.NamespacePause.Duration
+		if command := strings.Fields(c.BetweenNamespaceCheck); len(command) > 0 {
+			opts.NamespaceCheck = namespaceCheck(command)
+		}
+	}
+	return opts
+}
+
+// validate checks the resolved config for invalid option values
+func (c *config) validate() error {
+	switch c.Output {
+	case "table", "yaml", "json", "diff":
+	default:
+		return fmt.Errorf("invalid --output %q, expected table, yaml, json or diff", c.Output)
+	}
+	switch c.NotifyOn {
+	case "change", "error", "always":
+	default:
+		return fmt.Errorf("invalid --notify-on %q, expected change, error or always", c.NotifyOn)
+	}
+	if c.Replace && c.ManagementPrefix == "" {
+		return fmt.Errorf("--replace requires a non-empty --management-prefix")
+	}
+	switch c.NamespaceSource {
+	case namespaceSourceTemplates, namespaceSourceAll:
+	case namespaceSourceSelector:
+		if c.NamespaceSelector == "" && c.NamespaceRegex == "" {
+			return fmt.Errorf("--namespace-source=selector requires --namespace-selector or --namespace-regex")
+		}
+		if _, err := (namespaceFilter{selector: c.NamespaceSelector, regex: c.NamespaceRegex}).matcher(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid --namespace-source %q, expected templates, all or selector", c.NamespaceSource)
+	}
+	switch c.NamespaceMatch {
+	case namespaceMatchAnd, namespaceMatchOr:
+	default:
+		return fmt.Errorf("invalid --namespace-match %q, expected and or or", c.NamespaceMatch)
+	}
+	if c.NameAllNamespaces && c.NamespaceSource != namespaceSourceTemplates {
+		return fmt.Errorf("--name-all-namespaces requires --namespace-source=templates")
+	}
+	if c.ReportFormat != "junit" {
+		return fmt.Errorf("invalid --report-format %q, expected junit", c.ReportFormat)
+	}
+	switch c.LogFormat {
+	case "text", "json":
+	default:
+		return fmt.Errorf("invalid --log-format %q, expected text or json", c.LogFormat)
+	}
+	if c.BatchSize < 0 {
+		return fmt.Errorf("invalid --batch-size %d, expected 0 or more", c.BatchSize)
+	}
+	if c.BatchPause.Duration > 0 && c.BatchSize == 0 {
+		return fmt.Errorf("--batch-pause requires --batch-size")
+	}
+	if c.FailureThreshold < 1 {
+		return fmt.Errorf("invalid --failure-threshold %d, expected 1 or more", c.FailureThreshold)
+	}
+	if c.ReconcileNamespaceSerial && c.BatchSize > 0 {
+		return fmt.Errorf("--reconcile-namespace-serial and --batch-size are mutually exclusive")
+	}
+	if !c.ReconcileNamespaceSerial && (c.NamespacePause.Duration > 0 || c.BetweenNamespaceCheck != "") {
+		return fmt.Errorf("--namespace-pause and --between-namespace-check require --reconcile-namespace-serial")
+	}
+	if c.AuditLogMaxSize < 0 {
+		return fmt.Errorf("invalid --audit-log-max-size %d, expected 0 or more", c.AuditLogMaxSize)
+	}
+	if c.AuditLogMaxSize > 0 && c.AuditLog == "" {
+		return fmt.Errorf("--audit-log-max-size requires --audit-log")
+	}
+	if c.ForceConflicts && !c.ServerSide {
+		return fmt.Errorf("--force-conflicts requires --server-side")
+	}
+	if c.WatchConfig && (c.ConfigFile == "" || c.Interval.Duration <= 0) {
+		return fmt.Errorf("--watch-config requires --config and --interval")
+	}
+	if c.DryRun && c.DryRunServer {
+		return fmt.Errorf("--dry-run and --dry-run-server are mutually exclusive")
+	}
+	if c.WritePlan != "" && c.ApplyPlan != "" {
+		return fmt.Errorf("--write-plan and --apply-plan are mutually exclusive")
+	}
+	switch c.OnOverlap {
+	case secrettemplate.OverlapMerge, secrettemplate.OverlapWarn, secrettemplate.OverlapError:
+	default:
+		return fmt.Errorf("invalid --on-overlap %q, expected merge, warn or error", c.OnOverlap)
+	}
+	for _, v := range c.ListAnnotations {
+		if i := strings.Index(v, "="); i == 0 || i == len(v)-1 || v == "" {
+			return fmt.Errorf("invalid --list-annotation %q, expected key or key=separator", v)
+		}
+	}
+	if c.AnnotationMergeSeparator == "" {
+		return fmt.Errorf("--annotation-merge-separator cannot be empty")
+	}
+	switch c.MergeStrategy {
+	case secrettemplate.MergeReplace, secrettemplate.MergeDeep:
+	default:
+		return fmt.Errorf("invalid --merge-strategy %q, expected replace or deep", c.MergeStrategy)
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return fmt.Errorf("invalid --jitter %v, expected a fraction between 0 and 1", c.Jitter)
+	}
+	return nil
+}
+
+// redacted returns a copy of the config with sensitive values masked
+func (c config) redacted() config {
+	if c.NotifyWebhook != "" {
+		c.NotifyWebhook = "REDACTED"
+	}
+	return c
+}
+
+// printConfig writes the effective configuration as YAML to stdout, with sensitive values redacted
+func printConfig(c *config) error {
+	yd, err := yaml.Marshal(c.redacted())
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(yd)
+	return err
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// restartSettings are the settings applied once at startup, which a config reload keeps
+// at their running values
+type restartSettings struct {
+	Context              string
+	ExecEnv              stringList
+	KubeconfigFromSecret string
+	KubeconfigSecretKey  string
+	ExpectCluster        string
+	MetricsAddr          string
+	Incremental          bool
+	FullSyncInterval     duration
+	LogFormat            string
+	LogCaller            bool
+	Quiet                bool
+	OnlyChanged          bool
+	WatchConfig          bool
+}
+
+// restartSettings returns the settings of c applied once at startup
+func (c *config) restartSettings() restartSettings {
+	return restartSettings{
+		Context:              c.Context,
+		ExecEnv:              c.ExecEnv,
+		KubeconfigFromSecret: c.KubeconfigFromSecret,
+		KubeconfigSecretKey:  c.KubeconfigSecretKey,
+		ExpectCluster:        c.ExpectCluster,
+		MetricsAddr:          c.MetricsAddr,
+		Incremental:          c.Incremental,
+		FullSyncInterval:     c.FullSyncInterval,
+		LogFormat:            c.LogFormat,
+		LogCaller:            c.LogCaller,
+		Quiet:                c.Quiet,
+		OnlyChanged:          c.OnlyChanged,
+		WatchConfig:          c.WatchConfig,
+	}
+}
+
+// setRestartSettings sets the settings of c applied once at startup to r
+func (c *config) setRestartSettings(r restartSettings) {
+	c.Context = r.Context
+	c.ExecEnv = r.ExecEnv
+	c.KubeconfigFromSecret = r.KubeconfigFromSecret
+	c.KubeconfigSecretKey = r.KubeconfigSecretKey
+	c.ExpectCluster = r.ExpectCluster
+	c.MetricsAddr = r.MetricsAddr
+	c.Incremental = r.Incremental
+	c.FullSyncInterval = r.FullSyncInterval
+	c.LogFormat = r.LogFormat
+	c.LogCaller = r.LogCaller
+	c.Quiet = r.Quiet
+	c.OnlyChanged = r.OnlyChanged
+	c.WatchConfig = r.WatchConfig
+}
+
+// changedSettings returns the names of the settings differing between a and b
+func changedSettings(a, b restartSettings) []string {
+	var names []string
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < av.NumField(); i++ {
+		if !reflect.DeepEqual(av.Field(i).Interface(), bv.Field(i).Interface()) {
+			names = append(names, av.Type().Field(i).Name)
+		}
+	}
+	return names
+}
+
+// configWatcher reloads the configuration when the content of the config file changes
+type configWatcher struct {
+	path    string
+	args    []string
+	content []byte
+}
+
+// newConfigWatcher returns a configWatcher of the config file at path, resolving reloaded
+// configs against the command line arguments args like parseFlags
+func newConfigWatcher(path string, args []string) (*configWatcher, error) {
+	fd, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &configWatcher{path: path, args: args, content: fd}, nil
+}
+
+// reload returns the configuration resolved from the changed config file, or cur when
+// the file is unchanged, unreadable or the resolved configuration is invalid. The
+// settings applied once at startup keep their values from cur.
+func (w *configWatcher) reload(cur *config) *config {
+	l := log.WithFields(log.Fields{
+		"action": "reloadConfig",
+		"config": w.path,
+	})
+	fd, err := os.ReadFile(w.path)
+	if err != nil {
+		l.Warnf("read config file, keeping the current config: %v", err)
+		return cur
+	}
+	if bytes.Equal(fd, w.content) {
+		return cur
+	}
+	// an invalid file is reported once, not on every reconcile until it is fixed
+	w.content = fd
+	next, err := parseFlags(w.args)
+	if err != nil {
+		l.Errorf("invalid config, keeping the current config: %v", err)
+		return cur
+	}
+	if names := changedSettings(cur.restartSettings(), next.restartSettings()); len(names) > 0 {
+		l.Warnf("settings applied at startup changed, keeping the running values until restart: %v", names)
+	}
+	next.setRestartSettings(cur.restartSettings())
+	l.Print("reloaded config")
+	return next
+}
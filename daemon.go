@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// nextDelay returns how long to wait before the next reconcile. After consecutive
+// failures the interval is doubled per failure up to maxBackoff, and the result is
+// randomized by up to jitter of itself to spread load across replicas.
+func nextDelay(interval time.Duration, jitter float64, failures int, maxBackoff time.Duration) time.Duration {
+	d := interval
+	for i := 0; i < failures; i++ {
+		d *= 2
+		if d >= maxBackoff {
+			d = maxBackoff
+			break
+		}
+	}
+	if d < interval {
+		d = interval
+	}
+	if jitter > 0 {
+		d += time.Duration(jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// runDaemon reconciles on the configured interval until the process is signalled to
+// stop or ctx is done, returning an error only if ctx is past its deadline. With
+// --reconcile-once it stops after the first reconcile and returns its error. With
+// --watch-config a changed config file is reloaded before the next reconcile. With
+// --graceful-degrade, failures to reach the API server are retried on the next interval
+// without backoff, and only fail readiness once --failure-threshold of them happened in
+// a row.
+func runDaemon(ctx context.Context, cfg *config) error {
+	l := log.WithFields(log.Fields{
+		"action":   "runDaemon",
+		"interval": cfg.Interval.String(),
+	})
+	l.Print("runDaemon")
+	rand.Seed(time.Now().UnixNano())
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if cfg.MetricsAddr != "" {
+		mctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		serveMetrics(mctx, cfg.MetricsAddr)
+	}
+	var lister secretLister
+	if cfg.Incremental {
+		il := newIncrementalLister(cfg.FullSyncInterval.Duration)
+		lister = il.list
+	}
+	var cw *configWatcher
+	if cfg.WatchConfig {
+		w, err := newConfigWatcher(cfg.ConfigFile, os.Args[1:])
+		if err != nil {
+			return err
+		}
+		cw = w
+	}
+	failures, backoff := 0, 0
+	for {
+		if cw != nil {
+			cfg = cw.reload(cfg)
+		}
+		_, err := reconcile(ctx, cfg, lister)
+		switch {
+		case err == nil:
+			failures, backoff = 0, 0
+			setReady(true)
+		case cfg.GracefulDegrade && isTransientError(err):
+			failures++
+			l.Warnf("API unavailable, retrying next interval (%d consecutive failures): %v", failures, err)
+			if failures >= cfg.FailureThreshold {
+				setReady(false)
+			}
+		default:
+			failures++
+			backoff++
+			l.Errorf("reconcile failed (%d consecutive): %v", failures, err)
+			setReady(false)
+		}
+		failuresMetric.Set(float64(failures))
+		if cfg.ReconcileOnce {
+			lingerForScrape(ctx, cfg)
+			return err
+		}
+		delay := nextDelay(cfg.Interval.Duration, cfg.Jitter, backoff, cfg.MaxBackoff.Duration)
+		l.Infof("next reconcile at %s", time.Now().Add(delay).Format(time.RFC3339))
+		select {
+		case <-ctx.Done():
+			l.Print("stopping")
+			return deadlineErr(ctx)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// deadlineErr returns the error of ctx if it is past its deadline, as once --run-timeout
+// ends a daemon, and nil if it was cancelled or is not done, as on a signal
+func deadlineErr(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// lingerForScrape keeps the metrics endpoint up for --metrics-linger after a
+// --reconcile-once run so the final metrics can be scraped before the process exits
+func lingerForScrape(ctx context.Context, cfg *config) {
+	if cfg.MetricsAddr == "" || cfg.MetricsLinger.Duration <= 0 {
+		return
+	}
+	log.WithField("action", "lingerForScrape").Printf("serving final metrics for %s", cfg.MetricsLinger)
+	select {
+	case <-ctx.Done():
+	case <-time.After(cfg.MetricsLinger.Duration):
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// diffOptions controls the --output=diff rendering
+type diffOptions struct {
+	// Context is the number of unchanged keys shown around each changed key
+	Context int
+	// ShowUnchanged shows every unchanged key, overriding Context
+	ShowUnchanged bool
+}
+
+// diffLine is a single key of a metadata diff, op being ' ', '-' or '+'
+type diffLine struct {
+	op    byte
+	key   string
+	value string
+}
+
+// diffMetadata returns the key-sorted diff lines of the live and desired values of a
+// metadata map
+func diffMetadata(live, desired map[string]string) []diffLine {
+	all := make(map[string]string, len(live)+len(desired))
+	for k := range live {
+		all[k] = ""
+	}
+	for k := range desired {
+		all[k] = ""
+	}
+	var lines []diffLine
+	for _, k := range secrettemplate.SortedKeys(all) {
+		lv, lok := live[k]
+		dv, dok := desired[k]
+		switch {
+		case lok && dok && lv == dv:
+			lines = append(lines, diffLine{' ', k, lv})
+		default:
+			if lok {
+				lines = append(lines, diffLine{'-', k, lv})
+			}
+			if dok {
+				lines = append(lines, diffLine{'+', k, dv})
+			}
+		}
+	}
+	return lines
+}
+
+// writeDiffLines writes the changed lines, and the unchanged lines within opts.Context
+// lines of a change or all of them with opts.ShowUnchanged, of a metadata field
+func writeDiffLines(w io.Writer, field string, lines []diffLine, opts diffOptions) error {
+	show := make([]bool, len(lines))
+	changed := false
+	for i, dl := range lines {
+		if dl.op == ' ' {
+			show[i] = show[i] || opts.ShowUnchanged
+			continue
+		}
+		changed = true
+		for j := i - opts.Context; j <= i+opts.Context; j++ {
+			if j >= 0 && j < len(lines) {
+				show[j] = true
+			}
+		}
+	}
+	if !changed && !opts.ShowUnchanged {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "  %s:\n", field); err != nil {
+		return err
+	}
+	skipped := false
+	for i, dl := range lines {
+		if !show[i] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			if _, err := fmt.Fprintln(w, "   ..."); err != nil {
+				return err
+			}
+			skipped = false
+		}
+		if _, err := fmt.Fprintf(w, "%c   %s: %q\n", dl.op, dl.key, dl.value); err != nil {
+			return err
+		}
+	}
+	if skipped {
+		_, err := fmt.Fprintln(w, "   ...")
+		return err
+	}
+	return nil
+}
+
+// writeDiff writes a unified style diff of the live and merged metadata of each changed
+// secret to w
+func writeDiff(w io.Writer, secrets []*corev1.Secret, existing []corev1.Secret, changes []secrettemplate.Change, opts diffOptions) error {
+	for _, s := range secrets {
+		c := secrettemplate.FindChange(s, changes)
+		if c == nil {
+			continue
+		}
+		live := &corev1.Secret{}
+		for i, rs := range existing {
+			if rs.Namespace == s.Namespace && rs.Name == s.Name {
+				live = &existing[i]
+				break
+			}
+		}
+		from, to, annotations := fmt.Sprintf("%s/%s (live)", s.Namespace, s.Name), "merged", s.Annotations
+		if c.Create {
+			// as CreateSecret does, the directives are not copied to the created secret
+			from, to, annotations = "/dev/null", "created", secrettemplate.TemplateAnnotations(s)
+		}
+		if _, err := fmt.Fprintf(w, "--- %s\n+++ %s/%s (%s)\n", from, s.Namespace, s.Name, to); err != nil {
+			return err
+		}
+		if err := writeDiffLines(w, "annotations", diffMetadata(live.Annotations, annotations), opts); err != nil {
+			return err
+		}
+		if err := writeDiffLines(w, "labels", diffMetadata(live.Labels, s.Labels), opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,8 +3,12 @@ module github.com/umg/devops-k8s-secret-template-in-place
 go 1.16
 
 require (
+	github.com/google/cel-go v0.9.0
+	github.com/prometheus/client_golang v1.11.0
 	github.com/sirupsen/logrus v1.8.1
 	k8s.io/api v0.22.0
 	k8s.io/apimachinery v0.22.0
 	k8s.io/client-go v0.22.0
+	sigs.k8s.io/kustomize/api v0.8.11
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// ready is 1 while /readyz reports the process ready
+var ready int32
+
+// setReady sets whether /readyz reports the process ready
+func setReady(r bool) {
+	var v int32
+	if r {
+		v = 1
+	}
+	atomic.StoreInt32(&ready, v)
+}
+
+// readyHandler serves /readyz, 200 once a reconcile has succeeded and 503 after one has
+// failed, or with --graceful-degrade after --failure-threshold transient failures in a row
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&ready) == 1 {
+		w.Write([]byte("ok\n"))
+		return
+	}
+	http.Error(w, "not ready", http.StatusServiceUnavailable)
+}
+
+// isTransientError reports whether err is a failure to reach the API server, or an API
+// server response asking to retry, as opposed to an error retrying would not fix
+func isTransientError(err error) bool {
+	// a --run-timeout or signal ending the run is not an outage, though
+	// context.DeadlineExceeded is also a net.Error
+	if err == nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if apierrors.IsServiceUnavailable(err) || apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) {
+		return true
+	}
+	if utilnet.IsConnectionRefused(err) || utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err) || utilnet.IsNoRoutesError(err) {
+		return true
+	}
+	// a host which does not resolve or a certificate which does not verify stays so, and
+	// every *url.Error is a net.Error, so only timeouts and socket errors are retried
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	var oe *net.OpError
+	return errors.As(err, &oe)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// timeoutError is a network error reporting a timeout, as an exceeded dial or client
+// timeout does
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransientError(t *testing.T) {
+	gr := schema.GroupResource{Resource: "secrets"}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"service unavailable", apierrors.NewServiceUnavailable("etcd leader changed"), true},
+		{"server timeout", apierrors.NewServerTimeout(gr, "list", 1), true},
+		{"too many requests", apierrors.NewTooManyRequests("slow down", 1), true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{"wrapped connection refused", fmt.Errorf("list: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}), true},
+		{"dial timeout", &url.Error{Op: "Get", URL: "https://k8s", Err: &net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{}}}, true},
+		{"client timeout", &url.Error{Op: "Get", URL: "https://k8s", Err: timeoutError{}}, true},
+		{"read reset", &url.Error{Op: "Get", URL: "https://k8s", Err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}}, true},
+		{"temporary dns failure", &url.Error{Op: "Get", URL: "https://k8s", Err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Name: "k8s", IsTemporary: true}}}, true},
+		{"unknown host", &url.Error{Op: "Get", URL: "https://k8s", Err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Name: "k8s", Err: "no such host", IsNotFound: true}}}, false},
+		{"untrusted certificate", &url.Error{Op: "Get", URL: "https://k8s", Err: x509.UnknownAuthorityError{}}, false},
+		{"invalid certificate", &url.Error{Op: "Get", URL: "https://k8s", Err: x509.CertificateInvalidError{Reason: x509.Expired}}, false},
+		{"unauthorized", apierrors.NewUnauthorized("invalid token"), false},
+		{"forbidden", apierrors.NewForbidden(gr, "app", errors.New("no")), false},
+		{"not found", apierrors.NewNotFound(gr, "app"), false},
+		{"run timeout", fmt.Errorf("list: %w", context.DeadlineExceeded), false},
+		{"cancelled", context.Canceled, false},
+		{"other", errors.New("invalid template"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientError(tt.err); got != tt.want {
+				t.Errorf("isTransientError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeadlineErr(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-expired.Done()
+	cancelled, cancel2 := context.WithCancel(context.Background())
+	cancel2()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want error
+	}{
+		{"deadline exceeded", expired, context.DeadlineExceeded},
+		{"cancelled by a signal", cancelled, nil},
+		{"not done", context.Background(), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deadlineErr(tt.ctx); !errors.Is(got, tt.want) {
+				t.Errorf("deadlineErr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
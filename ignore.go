@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ignoreList holds namespace/name patterns of secrets which are never matched
+type ignoreList []string
+
+// loadIgnoreFile reads the ignore file at p, one namespace/name glob per line. Blank
+// lines and lines starting with # are skipped.
+func loadIgnoreFile(p string) (ignoreList, error) {
+	fd, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var list ignoreList
+	sc := bufio.NewScanner(bytes.NewReader(fd))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.Contains(line, "/") {
+			return nil, fmt.Errorf("ignore file %s:%d: expected namespace/name, got %q", p, n, line)
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("ignore file %s:%d: %w", p, n, err)
+		}
+		list = append(list, line)
+	}
+	return list, sc.Err()
+}
+
+// ignored returns true if the named secret matches an entry of the list
+func (list ignoreList) ignored(namespace, name string) bool {
+	for _, p := range list {
+		if ok, _ := path.Match(p, namespace+"/"+name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the secrets which do not match an entry of the list. With warnUnused,
+// entries which match no secret are warned about, which only makes sense when secrets are
+// every existing secret.
+func (list ignoreList) filter(secrets []corev1.Secret, warnUnused bool) []corev1.Secret {
+	l := log.WithFields(log.Fields{
+		"action": "filterIgnored",
+	})
+	if len(list) == 0 {
+		return secrets
+	}
+	used := make(map[string]bool)
+	var kept []corev1.Secret
+	for _, s := range secrets {
+		id := s.Namespace + "/" + s.Name
+		skip := false
+		for _, p := range list {
+			if ok, _ := path.Match(p, id); ok {
+				used[p] = true
+				skip = true
+			}
+		}
+		if skip {
+			l.Printf("ignoring secret %s", id)
+			continue
+		}
+		kept = append(kept, s)
+	}
+	for _, p := range list {
+		if warnUnused && !used[p] {
+			l.Warnf("ignore entry %q matches no secret", p)
+		}
+	}
+	return kept
+}
+
+// filterIgnoredCreates drops the changes which would create a secret on the list
+func (list ignoreList) filterIgnoredCreates(changes []secrettemplate.Change) []secrettemplate.Change {
+	var kept []secrettemplate.Change
+	for _, c := range changes {
+		if c.Create && list.ignored(c.Namespace, c.Name) {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
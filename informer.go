@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// templateNamespaces returns the namespaces of the templates as a reconcile resolves
+// them, including those found by --name-all-namespaces and --namespace-source
+func templateNamespaces(ctx context.Context, cfg *config) ([]string, error) {
+	sec, err := resolveTemplates(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return secrettemplate.SecretNamespaces(sec), nil
+}
+
+// runWatchSecrets reconciles once, then watches the template namespaces with a secret
+// informer and reconciles each secret as it is created or updated, until the process
+// is signalled to stop or ctx is done. A ctx past its deadline is returned as an error.
+func runWatchSecrets(ctx context.Context, cfg *config) error {
+	l := log.WithFields(log.Fields{
+		"action": "runWatchSecrets",
+	})
+	l.Print("runWatchSecrets")
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if _, err := reconcile(ctx, cfg, nil); err != nil {
+		l.Errorf("initial reconcile failed: %v", err)
+	}
+	namespaces, err := templateNamespaces(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	queue := workqueue.New()
+	defer queue.ShutDown()
+	enqueue := func(obj interface{}) {
+		if key, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+			queue.Add(key)
+		}
+	}
+	var stores []cache.Store
+	for _, ns := range namespaces {
+		f := informers.NewSharedInformerFactoryWithOptions(k8sClient, 0, informers.WithNamespace(ns))
+		inf := f.Core().V1().Secrets().Informer()
+		inf.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    enqueue,
+			UpdateFunc: func(_, obj interface{}) { enqueue(obj) },
+		})
+		stores = append(stores, inf.GetStore())
+		f.Start(ctx.Done())
+		if !cache.WaitForCacheSync(ctx.Done(), inf.HasSynced) {
+			return ctx.Err()
+		}
+		l.Printf("watching secrets in namespace %s", ns)
+	}
+	go func() {
+		<-ctx.Done()
+		queue.ShutDown()
+	}()
+	// secrets created by --create-missing are handled by the initial reconcile, event
+	// reconciles only see the secret of the event
+	ecfg := *cfg
+	ecfg.CreateMissing = false
+	for {
+		key, shutdown := queue.Get()
+		if shutdown {
+			l.Print("stopping")
+			return deadlineErr(ctx)
+		}
+		secret := lookupSecret(stores, key.(string))
+		if secret != nil {
+			l.Printf("secret event: %s", key)
+			lister := func(ctx context.Context, namespaces []string) ([]corev1.Secret, bool, error) {
+				return []corev1.Secret{*secret}, true, nil
+			}
+			if _, err := reconcile(ctx, &ecfg, lister); err != nil {
+				l.Errorf("reconcile %s failed: %v", key, err)
+			}
+		}
+		queue.Done(key)
+	}
+}
+
+// lookupSecret returns a copy of the secret with the namespace/name key from the first
+// informer store holding it, or nil if it has since been deleted
+func lookupSecret(stores []cache.Store, key string) *corev1.Secret {
+	for _, s := range stores {
+		obj, ok, err := s.GetByKey(key)
+		if err != nil || !ok {
+			continue
+		}
+		if secret, ok := obj.(*corev1.Secret); ok {
+			return secret.DeepCopy()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTemplateNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	templates := `apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+  namespace: default
+`
+	if err := os.WriteFile(filepath.Join(dir, "secrets.yaml"), []byte(templates), 0600); err != nil {
+		t.Fatal(err)
+	}
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	k8sClient = fake.NewSimpleClientset(
+		namespace("default", nil),
+		namespace("team-a", map[string]string{"team": "a"}),
+		namespace("team-b", nil),
+		fakeSecret("team-a", "app"),
+		fakeSecret("team-b", "app"),
+	)
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "template namespaces", args: []string{"--default-namespace", "ops"}, want: []string{"default", "ops"}},
+		{name: "name in all namespaces", args: []string{"--name-all-namespaces"}, want: []string{"default", "team-a", "team-b"}},
+		{name: "all namespaces", args: []string{"--namespace-source", "all"}, want: []string{"default", "team-a", "team-b"}},
+		{name: "selected namespaces", args: []string{"--namespace-source", "selector", "--namespace-selector", "team=a"}, want: []string{"team-a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseFlags(append(tt.args, dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := templateNamespaces(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("namespaces = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
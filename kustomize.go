@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+)
+
+// kustomizeSource is the output of the kustomization in dir, built with the kustomize API
+type kustomizeSource struct {
+	dir string
+}
+
+// Documents returns the rendered output of the kustomization as a single document
+func (s kustomizeSource) Documents() ([]secrettemplate.Document, error) {
+	l := log.WithFields(log.Fields{
+		"action": "kustomizeSource",
+		"dir":    s.dir,
+	})
+	l.Print("kustomize build")
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	rm, err := k.Run(filesys.MakeFsOnDisk(), s.dir)
+	if err != nil {
+		return nil, err
+	}
+	yd, err := rm.AsYaml()
+	if err != nil {
+		return nil, err
+	}
+	// includes are a template file feature, kustomize has its own composition
+	return []secrettemplate.Document{{Name: filepath.Join(s.dir, "kustomization.yaml"), Content: string(yd)}}, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// lastRunState is the document --since-last-run persists after each successful run
+type lastRunState struct {
+	// LastRun is when the last successful run started listing secrets, and LastFullSync
+	// when the last one processing every secret did
+	LastRun      time.Time `json:"lastRun"`
+	LastFullSync time.Time `json:"lastFullSync"`
+	// Templates is the digest of the templates and merge options the run applied
+	Templates string `json:"templates"`
+}
+
+// readLastRun returns the state stored at path, and false if there is none or it cannot
+// be read, in which case the run is a full sync
+func readLastRun(path string) (lastRunState, bool) {
+	var st lastRunState
+	fd, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, false
+	} else if err != nil {
+		log.WithField("action", "readLastRun").Warnf("read last run state %s, doing a full sync: %v", path, err)
+		return st, false
+	}
+	if err := json.Unmarshal(fd, &st); err != nil {
+		log.WithField("action", "readLastRun").Warnf("invalid last run state %s, doing a full sync: %v", path, err)
+		return lastRunState{}, false
+	}
+	return st, true
+}
+
+// writeLastRun stores the state at path, replacing the previous state atomically
+func writeLastRun(path string, st lastRunState) error {
+	jd, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(jd, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// templatesDigest returns a digest of what the templates apply, so a run after any change
+// to the templates or the merge options processes every secret
+func templatesDigest(templates []*corev1.Secret, opts secrettemplate.MergeOptions) string {
+	h := sha256.New()
+	_ = json.NewEncoder(h).Encode(templates)
+	_ = json.NewEncoder(h).Encode(opts)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sinceLastRun returns the state to store once a run started at start succeeds, and the
+// time to filter existing secrets by, zero when the run is a full sync: force is set,
+// there is no previous state, the templates changed or fullSync has passed since the last
+// full sync
+func sinceLastRun(path string, digest string, start time.Time, fullSync time.Duration, force bool) (lastRunState, time.Time) {
+	l := log.WithFields(log.Fields{
+		"action": "sinceLastRun",
+		"state":  path,
+	})
+	prev, ok := readLastRun(path)
+	next := lastRunState{LastRun: start, LastFullSync: start, Templates: digest}
+	switch {
+	case force:
+		l.Print("forced full sync")
+	case !ok:
+		l.Print("no last run state, full sync")
+	case prev.Templates != digest:
+		l.Print("templates changed since the last run, full sync")
+	case fullSync > 0 && start.Sub(prev.LastFullSync) >= fullSync:
+		l.Printf("last full sync at %s, full sync", prev.LastFullSync.Format(time.RFC3339))
+	default:
+		l.Printf("processing secrets changed since the last run at %s", prev.LastRun.Format(time.RFC3339))
+		next.LastFullSync = prev.LastFullSync
+		return next, prev.LastRun
+	}
+	return next, time.Time{}
+}
+
+// dropExistingCreates drops the changes which would create a secret that exists, as
+// secrets left out of the run by --since-last-run do
+func dropExistingCreates(changes []secrettemplate.Change, existing []corev1.Secret) []secrettemplate.Change {
+	found := make(map[string]bool, len(existing))
+	for _, s := range existing {
+		found[s.Namespace+"/"+s.Name] = true
+	}
+	var kept []secrettemplate.Change
+	for _, c := range changes {
+		if c.Create && found[c.Namespace+"/"+c.Name] {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
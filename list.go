@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// secretLister returns the existing secrets of the namespaces to reconcile. partial is
+// set when only some of them are returned, e.g. those changed since the last listing, so
+// that a template matching no returned secret does not mean its secret is missing.
+type secretLister func(ctx context.Context, namespaces []string) (secrets []corev1.Secret, partial bool, err error)
+
+// listNamespaceSecrets fetches the existing secrets of each namespace using up to
+// concurrency parallel requests. The result is ordered by namespace in the order given,
+// regardless of which request completes first.
+func listNamespaceSecrets(ctx context.Context, namespaces []string, concurrency int) ([]corev1.Secret, error) {
+	l := log.WithFields(
+		log.Fields{
+			"action":      "listNamespaceSecrets",
+			"namespaces":  len(namespaces),
+			"concurrency": concurrency,
+		})
+	l.Print("listNamespaceSecrets")
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([][]corev1.Secret, len(namespaces))
+	errs := make([]error, len(namespaces))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, ns := range namespaces {
+		wg.Add(1)
+		go func(i int, ns string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			l.Printf("get existing secrets in namespace: %s", ns)
+			results[i], errs[i] = getSecrets(ctx, ns)
+		}(i, ns)
+	}
+	wg.Wait()
+	var secrets []corev1.Secret
+	for i, ns := range namespaces {
+		if errs[i] != nil {
+			l.Errorf("namespace %s: %v", ns, errs[i])
+			return nil, errs[i]
+		}
+		l.Printf("namespace %s secrets: %d", ns, len(results[i]))
+		secrets = append(secrets, results[i]...)
+	}
+	return secrets, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// fakeSecret returns an existing secret with a UID derived from its namespace and name
+func fakeSecret(ns, name string) *corev1.Secret {
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name, UID: types.UID(ns + "-" + name)}}
+}
+
+func TestListNamespaceSecretsDedupe(t *testing.T) {
+	k8sClient = fake.NewSimpleClientset(fakeSecret("a", "one"), fakeSecret("a", "two"), fakeSecret("b", "one"))
+	tests := []struct {
+		name       string
+		namespaces []string
+		want       []string
+	}{
+		{name: "distinct namespaces", namespaces: []string{"a", "b"}, want: []string{"a/one", "a/two", "b/one"}},
+		{name: "duplicated namespace", namespaces: []string{"a", "b", "a"}, want: []string{"a/one", "a/two", "b/one"}},
+		{name: "namespace listed three times", namespaces: []string{"b", "b", "b"}, want: []string{"b/one"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listed, err := listNamespaceSecrets(context.Background(), tt.namespaces, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := secrettemplate.DedupeSecrets(listed)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d secrets, want %v", len(got), tt.want)
+			}
+			for i, s := range got {
+				if id := s.Namespace + "/" + s.Name; id != tt.want[i] {
+					t.Errorf("secret %d = %s, want %s", i, id, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// slowClient delays secret lists, as a remote API server would. The fake clientset
+// serializes its reactors, so the delay is added in front of it instead.
+type slowClient struct {
+	kubernetes.Interface
+	delay time.Duration
+}
+
+func (c slowClient) CoreV1() corev1client.CoreV1Interface {
+	return slowCoreV1{c.Interface.CoreV1(), c.delay}
+}
+
+type slowCoreV1 struct {
+	corev1client.CoreV1Interface
+	delay time.Duration
+}
+
+func (c slowCoreV1) Secrets(namespace string) corev1client.SecretInterface {
+	return slowSecrets{c.CoreV1Interface.Secrets(namespace), c.delay}
+}
+
+type slowSecrets struct {
+	corev1client.SecretInterface
+	delay time.Duration
+}
+
+func (s slowSecrets) List(ctx context.Context, opts metav1.ListOptions) (*corev1.SecretList, error) {
+	time.Sleep(s.delay)
+	return s.SecretInterface.List(ctx, opts)
+}
+
+// BenchmarkListNamespaceSecrets lists 50 namespaces from a fake cluster answering each
+// list after 2ms, serially and with increasing concurrency
+func BenchmarkListNamespaceSecrets(b *testing.B) {
+	out := log.StandardLogger().Out
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+	var objects []runtime.Object
+	var namespaces []string
+	for i := 0; i < 50; i++ {
+		ns := fmt.Sprintf("ns-%d", i)
+		namespaces = append(namespaces, ns)
+		for j := 0; j < 20; j++ {
+			objects = append(objects, fakeSecret(ns, fmt.Sprintf("secret-%d", j)))
+		}
+	}
+	k8sClient = slowClient{fake.NewSimpleClientset(objects...), 2 * time.Millisecond}
+	for _, concurrency := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := listNamespaceSecrets(context.Background(), namespaces, concurrency); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// callerPrettyfier renders the caller as file:line, dropping the function name
+func callerPrettyfier(f *runtime.Frame) (string, string) {
+	return "", fmt.Sprintf("%s:%d", filepath.Base(f.File), f.Line)
+}
+
+// configureLogging sets the log format and level, and whether entries carry their caller
+func configureLogging(cfg *config) {
+	switch cfg.LogFormat {
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{CallerPrettyfier: callerPrettyfier})
+	default:
+		log.SetFormatter(&log.TextFormatter{CallerPrettyfier: callerPrettyfier})
+	}
+	log.SetReportCaller(cfg.LogCaller)
+	if cfg.Quiet || cfg.OnlyChanged {
+		log.SetLevel(log.ErrorLevel)
+	}
+}
@@ -2,19 +2,18 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
-	"path"
 	"path/filepath"
-	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -22,11 +21,19 @@ import (
 )
 
 var (
-	k8sClient *kubernetes.Clientset
+	k8sClient kubernetes.Interface
+	// clusterServer is the API server URL of the managed cluster
+	clusterServer string
+	// clusterName is the kubeconfig cluster name of the managed cluster, empty in cluster
+	clusterName string
+	// clusterContext is the kubeconfig context of the managed cluster, empty in cluster
+	clusterContext string
+	// clusterUser is the user impersonated, or authenticated as by basic auth, if any
+	clusterUser string
 )
 
 // createKubeClient creates a global k8s client
-func createKubeClient() error {
+func createKubeClient(ctx context.Context, cfg *config) error {
 	l := log.WithFields(
 		log.Fields{
 			"action": "createKubeClient",
@@ -49,11 +56,50 @@ func createKubeClient() error {
 			return err
 		}
 	} else {
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+		kubeContext := cfg.Context
+		if kubeContext == "" {
+			kubeContext = os.Getenv("KUBE_CONTEXT")
+		}
+		if kubeContext != "" {
+			l.Printf("using context %s", kubeContext)
+		}
+		cc := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
+			&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+		)
+		config, err = cc.ClientConfig()
 		if err != nil {
-			l.Printf("clientcmd.BuildConfigFromFlags error=%v", err)
+			l.Printf("clientcmd.ClientConfig error=%v", err)
 			return err
 		}
+		if raw, err := cc.RawConfig(); err == nil {
+			clusterContext = kubeContext
+			if clusterContext == "" {
+				clusterContext = raw.CurrentContext
+			}
+			clusterName = contextCluster(raw, clusterContext)
+		}
+	}
+	if err := configureExecProvider(config, cfg.ExecEnv); err != nil {
+		l.Printf("configureExecProvider error=%v", err)
+		return err
+	}
+	if cfg.KubeconfigFromSecret != "" {
+		l.Printf("load target kubeconfig from secret %s", cfg.KubeconfigFromSecret)
+		config, clusterContext, clusterName, err = kubeconfigFromSecret(ctx, config, cfg.KubeconfigFromSecret, cfg.KubeconfigSecretKey)
+		if err != nil {
+			l.Printf("kubeconfigFromSecret error=%v", err)
+			return err
+		}
+		if err := configureExecProvider(config, cfg.ExecEnv); err != nil {
+			l.Printf("configureExecProvider error=%v", err)
+			return err
+		}
+	}
+	clusterServer = config.Host
+	clusterUser = config.Impersonate.UserName
+	if clusterUser == "" {
+		clusterUser = config.Username
 	}
 	k8sClient, err = kubernetes.NewForConfig(config)
 	if err != nil {
@@ -64,7 +110,7 @@ func createKubeClient() error {
 }
 
 // getSecrets returns all sync-enabled secrets managed by the cert-manager-sync operator
-func getSecrets(ns string) ([]corev1.Secret, error) {
+func getSecrets(ctx context.Context, ns string) ([]corev1.Secret, error) {
 	var slo []corev1.Secret
 	var err error
 	l := log.WithFields(
@@ -75,238 +121,279 @@ func getSecrets(ns string) ([]corev1.Secret, error) {
 	l.Print("get secrets")
 	sc := k8sClient.CoreV1().Secrets(ns)
 	lo := &metav1.ListOptions{}
-	sl, jerr := sc.List(context.Background(), *lo)
+	sl, jerr := sc.List(ctx, *lo)
 	if jerr != nil {
 		l.Printf("list error=%v", jerr)
-		return slo, jerr
+		return slo, secrettemplate.ClassifyAPIError(jerr)
 	}
 	l.Printf("range secrets: %d", len(sl.Items))
 	slo = append(slo, sl.Items...)
 	return slo, err
 }
 
-func getSecretFiles(dir string) []string {
-	files, err := os.ReadDir(dir)
+// run parses the templates and patches the matching existing secrets
+func run(ctx context.Context, cfg *config, lister secretLister) (*secrettemplate.Summary, error) {
+	l := log.WithFields(log.Fields{
+		"action": "run",
+	})
+	if cfg.ApplyPlan != "" {
+		return applyPlan(ctx, cfg)
+	}
+	summary := &secrettemplate.Summary{}
+	start := time.Now()
+	sec, err := resolveTemplates(ctx, cfg)
 	if err != nil {
-		log.Errorf("Failed to read directory: %s", err)
-		return nil
+		return summary, err
 	}
-
-	var secretFiles []string
-	for _, file := range files {
-		if !file.IsDir() {
-			secretFiles = append(secretFiles, path.Join(dir, file.Name()))
+	nsc := secrettemplate.SecretNamespaces(sec)
+	if lister == nil {
+		lister = func(ctx context.Context, namespaces []string) ([]corev1.Secret, bool, error) {
+			secrets, err := listNamespaceSecrets(ctx, namespaces, cfg.listConcurrency())
+			return secrets, false, err
 		}
 	}
-
-	return secretFiles
-}
-
-func parseFilesAsSecrets(files []string) ([]*corev1.Secret, error) {
-	l := log.WithFields(
-		log.Fields{
-			"action": "parseFilesAsSecrets",
-			"files":  len(files),
-		})
-	l.Print("parseFilesAsSecrets")
-	var secrets []*corev1.Secret
-	for _, file := range files {
-		l.Printf("file: %s", file)
-		fd, ferr := os.ReadFile(file)
-		if ferr != nil {
-			log.Errorf("Failed to read file: %s", ferr)
-			return nil, ferr
+	allSecrets, partial, err := lister(ctx, nsc)
+	if err != nil {
+		return summary, err
+	}
+	allSecrets = cfg.ignored.filter(secrettemplate.DedupeSecrets(allSecrets), !partial)
+	l.Printf("all existing secrets: %d", len(allSecrets))
+	if cfg.Since.Duration > 0 {
+		allSecrets = secrettemplate.FilterSecretsSince(allSecrets, cfg.Since.Duration)
+	}
+	if cfg.WaitForSecret.Duration > 0 && !partial {
+		if allSecrets, err = waitForSecrets(ctx, sec, allSecrets, cfg.ignored, cfg.WaitForSecret.Duration); err != nil {
+			return summary, err
 		}
-		content := removeComments(string(fd))
-		docs := strings.Split(content, "---")
-		for _, doc := range docs {
-			if strings.TrimSpace(doc) == "" {
-				continue
-			}
-			decode := scheme.Codecs.UniversalDeserializer().Decode
-			object, _, err := decode([]byte(doc), nil, nil)
-			if err != nil {
-				log.Errorf("Failed to decode secret: %s", err)
-				return nil, err
-			}
-			if object.GetObjectKind().GroupVersionKind() == corev1.SchemeGroupVersion.WithKind("Secret") {
-				s, ok := object.(*corev1.Secret)
-				if !ok {
-					l.Printf("object is not a secret")
-					return nil, fmt.Errorf("unexpected object type: %T", object)
-				}
-				l.Printf("secret: %s/%s", s.Namespace, s.Name)
-				secrets = append(secrets, s)
-			}
+	}
+	existing := allSecrets
+	var next lastRunState
+	if cfg.SinceLastRun != "" {
+		var since time.Time
+		next, since = sinceLastRun(cfg.SinceLastRun, templatesDigest(sec, cfg.mergeOptions()), start, cfg.FullSyncInterval.Duration, cfg.Force)
+		if !since.IsZero() {
+			allSecrets = secrettemplate.FilterSecretsChangedSince(allSecrets, since)
+			unchangedSkipsMetric.Add(float64(len(existing) - len(allSecrets)))
 		}
 	}
-	return secrets, nil
-}
-
-func removeComments(content string) string {
-	lines := strings.Split(content, "\n")
-	var result []string
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if !strings.HasPrefix(trimmed, "#") {
-			result = append(result, line)
+	secrettemplate.ResolveNameCase(sec, allSecrets, cfg.IgnoreCase)
+	if cfg.NewestOnly {
+		sec = secrettemplate.SelectNewest(sec, allSecrets)
+	}
+	if sec, err = secrettemplate.ResolveOverlaps(sec, allSecrets, cfg.OnOverlap); err != nil {
+		return summary, err
+	}
+	checksumSkips := 0
+	if !cfg.Force {
+		if allSecrets, checksumSkips, err = secrettemplate.SkipMatchingChecksums(sec, allSecrets, cfg.mergeOptions()); err != nil {
+			return summary, err
 		}
+		checksumSkipsMetric.Add(float64(checksumSkips))
 	}
-	return strings.Join(result, "\n")
-}
-
-func secretNamespaces(secrets []*corev1.Secret) []string {
-	var namespaces []string
-secretsLoop:
-	for _, secret := range secrets {
-		for _, n := range namespaces {
-			if secret.Namespace == n {
-				continue secretsLoop
-			}
+	summary.Templates = len(sec)
+	for _, t := range sec {
+		summary.Matched += len(secrettemplate.MatchingSecrets(t, allSecrets))
+	}
+	mopts := cfg.mergeOptions()
+	if partial {
+		// a template matching none of the listed secrets may well have its secret, so
+		// secrets are only created after a full listing
+		mopts.CreateMissing = false
+	}
+	us, changes, err := secrettemplate.MergeSecrets(sec, allSecrets, mopts)
+	if err != nil {
+		return summary, err
+	}
+	changes = secrettemplate.FilterForeignChanges(changes, allSecrets, cfg.FieldManager, cfg.RespectForeign)
+	if err := secrettemplate.CheckFieldOwnership(changes, allSecrets, cfg.FieldManager, cfg.StrictOwnership); err != nil {
+		return summary, err
+	}
+	if cfg.SinceLastRun != "" || checksumSkips > 0 {
+		changes = dropExistingCreates(changes, existing)
+	}
+	changes = cfg.ignored.filterIgnoredCreates(changes)
+	l.Printf("secrets to change: %d", len(changes))
+	summary.Changes = len(changes)
+	if cfg.IncludeEmptyNamespaces && !partial {
+		summary.EmptyNamespaces = emptyNamespaces(nsc, sec, allSecrets, changes)
+		l.Printf("namespaces without matching secrets: %d", len(summary.EmptyNamespaces))
+	}
+	if cfg.MaxChanges >= 0 && len(changes) > cfg.MaxChanges {
+		for i := range changes {
+			c := &changes[i]
+			l.Printf("would change: %s/%s %s", c.Namespace, c.Name, c)
 		}
-		namespaces = append(namespaces, secret.Namespace)
+		return summary, fmt.Errorf("%d secrets would change, exceeding --max-changes=%d", len(changes), cfg.MaxChanges)
 	}
-	return namespaces
-}
-
-func mergeAnnotations(annotations map[string]string, annotationsToMerge map[string]string) map[string]string {
-	for k, v := range annotationsToMerge {
-		annotations[k] = v
+	l.Printf("updated secrets: %+v", len(us))
+	if cfg.DumpEffectiveSecrets {
+		summary.Skipped = len(us)
+		return summary, writeEffectiveSecrets(os.Stdout, us, cfg.ShowData)
 	}
-	return annotations
-}
-
-func mergeLabels(labels map[string]string, labelsToMerge map[string]string) map[string]string {
-	for k, v := range labelsToMerge {
-		labels[k] = v
+	if cfg.WritePlan != "" {
+		summary.Skipped = len(us) - len(changes)
+		return summary, writePlan(cfg.WritePlan, newPlan(us, allSecrets, changes, cfg.IncludeData))
 	}
-	return labels
-}
-
-func updateSecretMetadata(newSecrets []*corev1.Secret, existingSecrets []corev1.Secret) ([]*corev1.Secret, error) {
-	l := log.WithFields(
-		log.Fields{
-			"action": "updateSecretMetadata",
-			"new":    len(newSecrets),
-			"old":    len(existingSecrets),
-		})
-	l.Print("updateSecretMetadata")
-newLoop:
-	for i, ls := range newSecrets {
-		l.Printf("new secret: %s/%s", ls.Namespace, ls.Name)
-		for _, rs := range existingSecrets {
-			l.Printf("existing secret: %s/%s", rs.Namespace, rs.Name)
-			if ls.Name == rs.Name && ls.Namespace == rs.Namespace {
-				l.Printf("update secret: %s/%s", ls.Namespace, ls.Name)
-				a := mergeAnnotations(rs.Annotations, newSecrets[i].Annotations)
-				lb := mergeLabels(rs.Labels, newSecrets[i].Labels)
-				newSecrets[i].Annotations = a
-				newSecrets[i].Labels = lb
-				continue newLoop
+	if cfg.DryRun {
+		summary.Skipped = len(us) - len(changes)
+		if len(changes) == 0 && cfg.OnlyChanged {
+			return summary, nil
+		}
+		if cfg.Output == "diff" {
+			return summary, writeDiff(os.Stdout, us, allSecrets, changes, diffOptions{
+				Context:       cfg.DiffContext,
+				ShowUnchanged: cfg.ShowUnchanged,
+			})
+		}
+		return summary, writePreview(os.Stdout, cfg.Output, us, changes)
+	}
+	popts := cfg.patchOptions()
+	if cfg.DryRunServer {
+		// nothing is persisted, so there is nothing to verify or revert
+		l.Print("server-side dry run, no secret is changed")
+		popts.ServerDryRun, popts.Verify, popts.Transactional, popts.Atomic = true, false, false, false
+	}
+	ps, err := secrettemplate.UpdateK8sSecretsMetadata(ctx, k8sClient, us, changes, popts)
+	if cfg.AuditLog != "" && !cfg.DryRunServer {
+		if aerr := writeAuditLog(cfg.AuditLog, cfg.AuditLogMaxSize, auditEntries(ps.Results, us, existing, currentActor(cfg))); aerr != nil {
+			l.Errorf("failed to write audit log: %v", aerr)
+			if err == nil {
+				err = fmt.Errorf("audit log %s: %w", cfg.AuditLog, aerr)
 			}
 		}
 	}
-	return newSecrets, nil
+	if err == nil && cfg.SinceLastRun != "" && !cfg.DryRunServer {
+		if werr := writeLastRun(cfg.SinceLastRun, next); werr != nil {
+			l.Errorf("failed to write last run state: %v", werr)
+		}
+	}
+	ps.Templates, ps.Matched, ps.Changes = summary.Templates, summary.Matched, summary.Changes
+	ps.EmptyNamespaces = summary.EmptyNamespaces
+	return ps, err
 }
 
-func patchSecretMetadata(secret *corev1.Secret) error {
-	l := log.WithFields(
-		log.Fields{
-			"action": "patchSecretMetadata",
-			"secret": secret.Namespace + "/" + secret.Name,
-		},
-	)
-	l.Print("patchSecretMetadata")
-	patchData := map[string]interface{}{
-		"metadata": map[string]interface{}{
-			"annotations": secret.Annotations,
-			"labels":      secret.Labels,
-		},
+// reconcile runs once and reports the outcome to the configured sinks. A nil lister
+// lists every existing secret of the template namespaces.
+func reconcile(ctx context.Context, cfg *config, lister secretLister) (*secrettemplate.Summary, error) {
+	l := log.WithFields(log.Fields{
+		"action": "reconcile",
+	})
+	start := time.Now()
+	summary, rerr := run(ctx, cfg, lister)
+	recordMetrics(summary, rerr, time.Since(start))
+	if cfg.Report != "" {
+		if werr := writeReport(cfg.Report, cfg.ReportFormat, summary, rerr, start, time.Since(start)); werr != nil {
+			l.Errorf("failed to write report: %v", werr)
+		}
 	}
-	jd, err := json.Marshal(patchData)
-	if err != nil {
-		l.Printf("json marshal error: %v", err)
-		return err
+	if cfg.StatusConfigMap != "" {
+		if serr := writeStatusConfigMap(ctx, cfg.StatusConfigMap, summary, rerr); serr != nil {
+			l.Errorf("failed to write status configmap: %v", serr)
+		}
 	}
-	sc := k8sClient.CoreV1().Secrets(secret.Namespace)
-	_, err = sc.Patch(context.Background(), secret.Name, types.MergePatchType, jd, metav1.PatchOptions{})
-	if err != nil {
-		// if it's not found, ignore
-		if strings.Contains(err.Error(), "not found") {
-			return nil
+	if cfg.NotifyWebhook != "" && shouldNotify(cfg.NotifyOn, summary, rerr) {
+		if nerr := sendNotification(cfg.NotifyWebhook, cfg.DryRun || cfg.DryRunServer, summary, rerr); nerr != nil {
+			l.Errorf("failed to send notification: %v", nerr)
 		}
-		l.Printf("patch error: %v", err)
-		return err
 	}
-	return nil
-}
-
-func updateK8sSecretsMetadata(secrets []*corev1.Secret) error {
-	l := log.WithFields(
-		log.Fields{
-			"action":  "updateK8sSecretsMetadata",
-			"secrets": len(secrets),
-		})
-	l.Print("updateK8sSecretsMetadata")
-	for _, secret := range secrets {
-		l.Printf("secret: %s/%s %s", secret.Namespace, secret.Name, secret.UID)
-		err := patchSecretMetadata(secret)
-		if err != nil {
-			l.Printf("error: %v", err)
-			return err
+	switch {
+	case cfg.SummaryOnly:
+		if err := writeSummaryLine(os.Stdout, summary, rerr, time.Since(start)); err != nil {
+			l.Errorf("failed to write summary: %v", err)
+		}
+	case cfg.OnlyChanged:
+		if err := writeChanged(os.Stdout, summary); err != nil {
+			l.Errorf("failed to write changes: %v", err)
 		}
+	case cfg.Quiet:
+		fmt.Println(summary)
+	default:
+		l.Infof("summary: %s", summary)
 	}
-	return nil
+	return summary, rerr
 }
 
-func init() {
-	l := log.WithFields(
-		log.Fields{
-			"action": "init",
-		},
-	)
-	l.Print("init")
-	cerr := createKubeClient()
-	if cerr != nil {
-		l.Fatal(cerr)
+// exitRunError exits with exitTimeout if err is the run exceeding --run-timeout, and
+// fails with err otherwise
+func exitRunError(l *log.Entry, cfg *config, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		l.Errorf("run timed out after %s: %v", cfg.RunTimeout, err)
+		os.Exit(exitTimeout)
 	}
+	l.Fatal(err)
 }
 
 func main() {
 	l := log.WithFields(log.Fields{
 		"module": "main",
 	})
+	cfg, ferr := parseFlags(os.Args[1:])
+	if errors.Is(ferr, flag.ErrHelp) {
+		return
+	} else if ferr != nil {
+		l.Fatal(ferr)
+	}
+	if cfg.PrintConfig {
+		if perr := printConfig(cfg); perr != nil {
+			l.Fatal(perr)
+		}
+		return
+	}
+	if cfg.PrintRBAC {
+		if perr := writeRBAC(os.Stdout, cfg); perr != nil {
+			l.Fatal(perr)
+		}
+		return
+	}
+	configureLogging(cfg)
 	l.Info("starting")
-	secretDir := os.Getenv("SECRETS_DIR")
-	if secretDir == "" && len(os.Args) > 1 {
-		secretDir = os.Args[1]
+	ctx := context.Background()
+	if cfg.RunTimeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.RunTimeout.Duration)
+		defer cancel()
 	}
-	secretFiles := getSecretFiles(secretDir)
-	sec, err := parseFilesAsSecrets(secretFiles)
-	if err != nil {
-		l.Fatal(err)
-	}
-	l.Printf("parsed secrets: %d", len(sec))
-	nsc := secretNamespaces(sec)
-	var allSecrets []corev1.Secret
-	for _, ns := range nsc {
-		l.Printf("get existing secrets in namespace: %s", ns)
-		s, err := getSecrets(ns)
-		if err != nil {
-			l.Fatal(err)
+	cerr := createKubeClient(ctx, cfg)
+	if cerr != nil {
+		exitRunError(l, cfg, cerr)
+	}
+	if eerr := checkExpectedCluster(cfg.ExpectCluster); eerr != nil {
+		l.Fatal(eerr)
+	}
+	if cfg.ListManaged {
+		if merr := listManaged(ctx, cfg, os.Stdout); merr != nil {
+			l.Fatal(merr)
 		}
-		l.Printf("secrets: %d", len(s))
-		allSecrets = append(allSecrets, s...)
+		return
 	}
-	l.Printf("all existing secrets: %d", len(allSecrets))
-	us, uerr := updateSecretMetadata(sec, allSecrets)
-	if uerr != nil {
-		l.Fatal(uerr)
+	if cfg.WatchSecrets {
+		if werr := runWatchSecrets(ctx, cfg); werr != nil {
+			exitRunError(l, cfg, werr)
+		}
+		l.Info("done")
+		return
 	}
-	l.Printf("updated secrets: %+v", len(us))
-	uerr = updateK8sSecretsMetadata(us)
-	if uerr != nil {
-		l.Fatal(uerr)
+	if cfg.Interval.Duration > 0 || cfg.ReconcileOnce {
+		derr := runDaemon(ctx, cfg)
+		if cfg.ReconcileOnce && cfg.Pushgateway != "" {
+			pushMetrics(cfg.Pushgateway, cfg.PushgatewayJob)
+		}
+		if derr != nil {
+			exitRunError(l, cfg, derr)
+		}
+		l.Info("done")
+		return
+	}
+	summary, rerr := reconcile(ctx, cfg, nil)
+	if cfg.Pushgateway != "" {
+		pushMetrics(cfg.Pushgateway, cfg.PushgatewayJob)
+	}
+	if rerr != nil {
+		exitRunError(l, cfg, rerr)
+	}
+	if (cfg.DryRun || cfg.DryRunServer) && cfg.DetailedExitCode && summary.Changes > 0 {
+		l.Info("changes detected")
+		os.Exit(exitChanges)
 	}
 	l.Info("done")
 }
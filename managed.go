@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+)
+
+// managed secret statuses of --list-managed
+const (
+	managedInSync    = "in-sync"
+	managedDrifted   = "drifted"
+	managedUnmatched = "unmatched"
+)
+
+// listManaged writes the secrets of the template namespaces the tool manages to w, with
+// their stored checksum and whether the current templates match them and would change
+// them. Nothing is written to
+// the cluster.
+func listManaged(ctx context.Context, cfg *config, w io.Writer) error {
+	l := log.WithFields(log.Fields{
+		"action": "listManaged",
+	})
+	sec, err := resolveTemplates(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	allSecrets, err := listNamespaceSecrets(ctx, secrettemplate.SecretNamespaces(sec), cfg.listConcurrency())
+	if err != nil {
+		return err
+	}
+	allSecrets = cfg.ignored.filter(secrettemplate.DedupeSecrets(allSecrets), true)
+	secrettemplate.ResolveNameCase(sec, allSecrets, cfg.IgnoreCase)
+	if cfg.NewestOnly {
+		sec = secrettemplate.SelectNewest(sec, allSecrets)
+	}
+	if sec, err = secrettemplate.ResolveOverlaps(sec, allSecrets, cfg.OnOverlap); err != nil {
+		return err
+	}
+	_, changes, err := secrettemplate.MergeSecrets(sec, allSecrets, cfg.mergeOptions())
+	if err != nil {
+		return err
+	}
+	matched := map[string]bool{}
+	for _, t := range sec {
+		for _, s := range secrettemplate.MatchingSecrets(t, allSecrets) {
+			matched[s.Namespace+"/"+s.Name] = true
+		}
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tNAME\tCHECKSUM\tSTATUS\tCHANGES")
+	n := 0
+	for i := range allSecrets {
+		s := &allSecrets[i]
+		if !secrettemplate.IsManaged(*s, cfg.FieldManager, cfg.ManagementPrefix) {
+			continue
+		}
+		n++
+		status, pending := managedUnmatched, "-"
+		if c := secrettemplate.FindChange(s, changes); c != nil {
+			status = managedDrifted
+			keys := append(append(append([]string{}, c.Annotations...), c.Labels...), c.Data...)
+			removed := append(append([]string{}, c.RemoveAnnotations...), c.RemoveLabels...)
+			pending = secrettemplate.JoinOrDash(keys, removed)
+		} else if matched[s.Namespace+"/"+s.Name] {
+			status = managedInSync
+		}
+		checksum := "-"
+		if v, ok := s.Annotations[secrettemplate.ChecksumAnnotation]; ok {
+			checksum = v
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", s.Namespace, s.Name, checksum, status, pending)
+	}
+	l.Printf("managed secrets: %d of %d", n, len(allSecrets))
+	return tw.Flush()
+}
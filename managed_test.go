@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestListManagedChecksum(t *testing.T) {
+	dir := t.TempDir()
+	templates := `apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+  namespace: default
+  annotations:
+    owner: team-a
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+  namespace: default
+  annotations:
+    owner: team-a
+`
+	if err := os.WriteFile(filepath.Join(dir, "secrets.yaml"), []byte(templates), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseFlags([]string{"--checksum", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// app as the tool last wrote it, db written by an older template
+	parsed, err := loadTemplates(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, _, err := secrettemplate.MergeSecrets(parsed[:1], []corev1.Secret{*fakeSecret("default", "app")}, cfg.mergeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fakeSecret("default", "app")
+	app.Annotations = merged[0].Annotations
+	db := fakeSecret("default", "db")
+	db.Annotations = map[string]string{"owner": "team-a", secrettemplate.ChecksumAnnotation: "stale"}
+	legacy := fakeSecret("default", "legacy")
+	legacy.Annotations = map[string]string{"k8s-secret-template/owner": "team-a"}
+	k8sClient = fake.NewSimpleClientset(app, db, legacy, fakeSecret("default", "unmanaged"))
+
+	var out bytes.Buffer
+	if err := listManaged(context.Background(), cfg, &out); err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		got = append(got, strings.Fields(line))
+	}
+	want := [][]string{
+		{"NAMESPACE", "NAME", "CHECKSUM", "STATUS", "CHANGES"},
+		{"default", "app", app.Annotations[secrettemplate.ChecksumAnnotation], managedInSync, "-"},
+		{"default", "db", "stale", managedDrifted, secrettemplate.ChecksumAnnotation},
+		{"default", "legacy", "-", managedUnmatched, "-"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("output =\n%s\nwant %v", out.String(), want)
+	}
+	if len(app.Annotations[secrettemplate.ChecksumAnnotation]) != 64 {
+		t.Errorf("app checksum = %q, want a sha256", app.Annotations[secrettemplate.ChecksumAnnotation])
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+)
+
+// metricsRegistry holds the metrics of the reconciles run by the process
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	secretsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8s_secret_template_secrets_total",
+		Help: "Secrets processed, by action.",
+	}, []string{"action"})
+	reconcilesMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8s_secret_template_reconciles_total",
+		Help: "Reconciles run, by result.",
+	}, []string{"result"})
+	durationMetric = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "k8s_secret_template_last_reconcile_duration_seconds",
+		Help: "Duration of the last reconcile.",
+	})
+	lastRunMetric = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "k8s_secret_template_last_reconcile_timestamp_seconds",
+		Help: "Unix time the last reconcile completed.",
+	})
+	lastChangeMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "k8s_secret_template_namespace_last_change_timestamp_seconds",
+		Help: "Unix time a secret of the namespace was last patched or created.",
+	}, []string{"namespace"})
+	unchangedSkipsMetric = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "k8s_secret_template_unchanged_skips_total",
+		Help: "Secrets skipped by --since-last-run as unchanged since the last run.",
+	})
+	checksumSkipsMetric = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "k8s_secret_template_checksum_skips_total",
+		Help: "Secrets skipped by --checksum as already holding the checksum of their template.",
+	})
+	resourceVersionMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "k8s_secret_template_namespace_resource_version",
+		Help: "Last resourceVersion of the namespace's secrets seen by --incremental.",
+	}, []string{"namespace"})
+	failuresMetric = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "k8s_secret_template_consecutive_failures",
+		Help: "Reconciles failed in a row, 0 after a successful reconcile.",
+	})
+)
+
+// maxNamespaceSeries bounds the namespaces lastChangeMetric has a series for
+const maxNamespaceSeries = 1000
+
+// changedNamespaces are the namespaces lastChangeMetric has a series for
+var changedNamespaces = map[string]bool{}
+
+// versionNamespaces are the namespaces resourceVersionMetric has a series for
+var versionNamespaces = map[string]bool{}
+
+func init() {
+	metricsRegistry.MustRegister(secretsMetric, reconcilesMetric, durationMetric, lastRunMetric, lastChangeMetric, failuresMetric, unchangedSkipsMetric, checksumSkipsMetric, resourceVersionMetric)
+}
+
+// recordMetrics adds the outcome of a reconcile which took d to the metrics
+func recordMetrics(summary *secrettemplate.Summary, runErr error, d time.Duration) {
+	secretsMetric.WithLabelValues(secrettemplate.ActionPatched).Add(float64(summary.Patched))
+	secretsMetric.WithLabelValues(secrettemplate.ActionCreated).Add(float64(summary.Created))
+	secretsMetric.WithLabelValues(secrettemplate.ActionSkipped).Add(float64(summary.Skipped))
+	secretsMetric.WithLabelValues(secrettemplate.ActionError).Add(float64(summary.Errors))
+	result := "success"
+	if runErr != nil {
+		result = "error"
+	}
+	reconcilesMetric.WithLabelValues(result).Inc()
+	durationMetric.Set(d.Seconds())
+	lastRunMetric.SetToCurrentTime()
+	for _, r := range summary.Results {
+		if r.Action != secrettemplate.ActionPatched && r.Action != secrettemplate.ActionCreated {
+			continue
+		}
+		if !changedNamespaces[r.Namespace] {
+			if len(changedNamespaces) >= maxNamespaceSeries {
+				continue
+			}
+			changedNamespaces[r.Namespace] = true
+		}
+		lastChangeMetric.WithLabelValues(r.Namespace).SetToCurrentTime()
+	}
+}
+
+// recordResourceVersion sets the resourceVersion metric of the namespace. resourceVersions
+// are opaque, so one which is not a number, as etcd's are, is only logged.
+func recordResourceVersion(ns string, rv string) {
+	v, err := strconv.ParseFloat(rv, 64)
+	if err != nil {
+		return
+	}
+	if !versionNamespaces[ns] {
+		if len(versionNamespaces) >= maxNamespaceSeries {
+			return
+		}
+		versionNamespaces[ns] = true
+	}
+	resourceVersionMetric.WithLabelValues(ns).Set(v)
+}
+
+// serveMetrics serves the metrics on addr at /metrics, and readiness at /readyz, until
+// ctx is done
+func serveMetrics(ctx context.Context, addr string) {
+	l := log.WithFields(log.Fields{
+		"action": "serveMetrics",
+		"addr":   addr,
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/readyz", readyHandler)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(sctx)
+	}()
+	go func() {
+		l.Print("serving metrics")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			l.Errorf("metrics server: %v", err)
+		}
+	}()
+}
+
+// pushMetrics pushes the metrics to the Pushgateway at url under the job label, logging
+// rather than returning a failure so the push never fails the run
+func pushMetrics(url string, job string) {
+	l := log.WithFields(log.Fields{
+		"action": "pushMetrics",
+		"job":    job,
+	})
+	if err := push.New(url, job).Gatherer(metricsRegistry).Push(); err != nil {
+		l.Errorf("failed to push metrics: %v", err)
+		return
+	}
+	l.Print("pushed metrics")
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecordResourceVersion(t *testing.T) {
+	recordResourceVersion("rv-test", "12345")
+	if got := testutil.ToFloat64(resourceVersionMetric.WithLabelValues("rv-test")); got != 12345 {
+		t.Errorf("resourceVersion metric = %v, want 12345", got)
+	}
+	recordResourceVersion("rv-test", "not-a-number")
+	if got := testutil.ToFloat64(resourceVersionMetric.WithLabelValues("rv-test")); got != 12345 {
+		t.Errorf("resourceVersion metric after an opaque version = %v, want 12345", got)
+	}
+	recordResourceVersion("rv-opaque", "abc")
+	if versionNamespaces["rv-opaque"] {
+		t.Error("opaque resourceVersion added a series")
+	}
+}
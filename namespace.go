@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// inClusterNamespaceFile is where the service account's namespace is mounted in a pod
+const inClusterNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// inClusterNamespace returns the namespace of the pod the tool is running in, if any
+func inClusterNamespace() string {
+	d, err := os.ReadFile(inClusterNamespaceFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(d))
+}
+
+// resolveDefaultNamespace returns the namespace to use for templates that omit one
+func resolveDefaultNamespace(flagNamespace string) string {
+	if flagNamespace != "" {
+		return flagNamespace
+	}
+	return inClusterNamespace()
+}
+
+// applyDefaultNamespace sets ns on every secret that does not define a namespace. When ns
+// is empty too, those secrets are dropped, as listing their namespace would list secrets
+// cluster-wide.
+func applyDefaultNamespace(secrets []*corev1.Secret, ns string) []*corev1.Secret {
+	l := log.WithFields(
+		log.Fields{
+			"action":    "applyDefaultNamespace",
+			"namespace": ns,
+		})
+	var kept []*corev1.Secret
+	for _, s := range secrets {
+		if s.Namespace == "" && ns == "" {
+			l.Warnf("skipping secret %s, it has no namespace and no default namespace is available", s.Name)
+			continue
+		}
+		if s.Namespace == "" {
+			l.Printf("secret %s defaulted to namespace %s", s.Name, ns)
+			s.Namespace = ns
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// expandAllNamespaces replaces each template without a namespace with a copy per
+// namespace holding an existing secret of its name, listing secrets cluster-wide
+func expandAllNamespaces(ctx context.Context, secrets []*corev1.Secret) ([]*corev1.Secret, error) {
+	l := log.WithFields(
+		log.Fields{
+			"action": "expandAllNamespaces",
+		})
+	var expanded []*corev1.Secret
+	for _, s := range secrets {
+		if s.Namespace != "" {
+			expanded = append(expanded, s)
+			continue
+		}
+		sl, err := k8sClient.CoreV1().Secrets("").List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("metadata.name", s.Name).String(),
+		})
+		if err != nil {
+			return nil, secrettemplate.ClassifyAPIError(err)
+		}
+		l.Printf("secret %s exists in %d namespaces", s.Name, len(sl.Items))
+		for _, rs := range sl.Items {
+			es := s.DeepCopy()
+			es.Namespace = rs.Namespace
+			expanded = append(expanded, es)
+		}
+	}
+	return expanded, nil
+}
+
+// namespace sources of --namespace-source
+const (
+	namespaceSourceTemplates = "templates"
+	namespaceSourceAll       = "all"
+	namespaceSourceSelector  = "selector"
+)
+
+// namespace filter combinations of --namespace-match
+const (
+	namespaceMatchAnd = "and"
+	namespaceMatchOr  = "or"
+)
+
+// namespaceFilter selects discovered namespaces by a label selector and a name regex.
+// An empty selector or regex is not applied, and when both are set a namespace must
+// match both, or either with or set.
+type namespaceFilter struct {
+	selector string
+	regex    string
+	or       bool
+}
+
+// matcher returns a function reporting whether a namespace matches the filter
+func (f namespaceFilter) matcher() (func(ns *corev1.Namespace) bool, error) {
+	sel, err := labels.Parse(f.selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --namespace-selector %q: %w", f.selector, err)
+	}
+	re, err := regexp.Compile(f.regex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --namespace-regex %q: %w", f.regex, err)
+	}
+	return func(ns *corev1.Namespace) bool {
+		switch {
+		case f.selector == "":
+			return re.MatchString(ns.Name)
+		case f.regex == "":
+			return sel.Matches(labels.Set(ns.Labels))
+		case f.or:
+			return sel.Matches(labels.Set(ns.Labels)) || re.MatchString(ns.Name)
+		}
+		return sel.Matches(labels.Set(ns.Labels)) && re.MatchString(ns.Name)
+	}, nil
+}
+
+// discoverNamespaces lists the names of the cluster's namespaces matching the filter. A
+// filter matching no namespace is an error, as it would silently scope the run to nothing.
+func discoverNamespaces(ctx context.Context, filter namespaceFilter) ([]string, error) {
+	matches, err := filter.matcher()
+	if err != nil {
+		return nil, err
+	}
+	nl, err := k8sClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, secrettemplate.ClassifyAPIError(err)
+	}
+	var namespaces []string
+	for i, ns := range nl.Items {
+		if matches(&nl.Items[i]) {
+			namespaces = append(namespaces, ns.Name)
+		}
+	}
+	if len(namespaces) == 0 && (filter.selector != "" || filter.regex != "") {
+		return nil, fmt.Errorf("no namespace matches --namespace-selector %q and --namespace-regex %q", filter.selector, filter.regex)
+	}
+	return namespaces, nil
+}
+
+// scopeTemplates applies each template without a namespace to every one of namespaces.
+// With restrict set, templates naming a namespace which is not in namespaces are dropped.
+func scopeTemplates(secrets []*corev1.Secret, namespaces []string, restrict bool) []*corev1.Secret {
+	l := log.WithFields(
+		log.Fields{
+			"action":     "scopeTemplates",
+			"namespaces": len(namespaces),
+		})
+	in := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		in[ns] = true
+	}
+	var scoped []*corev1.Secret
+	for _, s := range secrets {
+		if s.Namespace != "" {
+			if restrict && !in[s.Namespace] {
+				l.Warnf("skip secret %s/%s outside the selected namespaces", s.Namespace, s.Name)
+				continue
+			}
+			scoped = append(scoped, s)
+			continue
+		}
+		for _, ns := range namespaces {
+			ss := s.DeepCopy()
+			ss.Namespace = ns
+			scoped = append(scoped, ss)
+		}
+	}
+	return scoped
+}
+
+// emptyNamespaces returns the listed namespaces in which no template matched an existing
+// secret and no secret is to be created
+func emptyNamespaces(namespaces []string, templates []*corev1.Secret, existing []corev1.Secret, changes []secrettemplate.Change) []string {
+	used := map[string]bool{}
+	for _, t := range templates {
+		for _, s := range secrettemplate.MatchingSecrets(t, existing) {
+			used[s.Namespace] = true
+		}
+	}
+	for _, c := range changes {
+		used[c.Namespace] = true
+	}
+	var empty []string
+	for _, ns := range namespaces {
+		if !used[ns] {
+			empty = append(empty, ns)
+		}
+	}
+	return empty
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+)
+
+// notification is the JSON payload posted to --notify-webhook. Text carries a human
+// readable summary so the payload can be posted directly to a Slack incoming webhook.
+type notification struct {
+	Text    string                  `json:"text"`
+	Time    time.Time               `json:"time"`
+	Cluster string                  `json:"cluster"`
+	Context string                  `json:"context,omitempty"`
+	DryRun  bool                    `json:"dryRun"`
+	Summary *secrettemplate.Summary `json:"summary"`
+	Error   string                  `json:"error,omitempty"`
+}
+
+// shouldNotify reports whether a run outcome matches the --notify-on filter
+func shouldNotify(on string, summary *secrettemplate.Summary, runErr error) bool {
+	switch on {
+	case "always":
+		return true
+	case "error":
+		return runErr != nil || summary.Errors > 0
+	case "change":
+		return runErr != nil || summary.Errors > 0 || summary.Changes > 0
+	}
+	return false
+}
+
+// sendNotification posts the run outcome to the webhook url
+func sendNotification(url string, dryRun bool, summary *secrettemplate.Summary, runErr error) error {
+	l := log.WithFields(
+		log.Fields{
+			"action": "sendNotification",
+		})
+	l.Print("sendNotification")
+	n := notification{
+		Time:    time.Now().UTC(),
+		Cluster: clusterServer,
+		Context: clusterContext,
+		DryRun:  dryRun,
+		Summary: summary,
+	}
+	target := clusterServer
+	if clusterContext != "" {
+		target = fmt.Sprintf("%s (%s)", clusterContext, clusterServer)
+	}
+	n.Text = fmt.Sprintf("k8s-secret-template on %s: %s", target, summary)
+	if runErr != nil {
+		n.Error = runErr.Error()
+		n.Text += " error: " + n.Error
+	}
+	jd, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	hc := &http.Client{Timeout: 10 * time.Second}
+	resp, err := hc.Post(url, "application/json", bytes.NewReader(jd))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
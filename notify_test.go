@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+)
+
+func TestSendNotificationContext(t *testing.T) {
+	defer func(server, context string) { clusterServer, clusterContext = server, context }(clusterServer, clusterContext)
+	tests := []struct {
+		name        string
+		context     string
+		wantContext string
+		wantText    string
+	}{
+		{name: "kubeconfig context", context: "prod", wantContext: "prod", wantText: "k8s-secret-template on prod (https://api.example.com): "},
+		{name: "in-cluster", wantText: "k8s-secret-template on https://api.example.com: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusterServer, clusterContext = "https://api.example.com", tt.context
+			var got map[string]interface{}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Error(err)
+				}
+			}))
+			defer ts.Close()
+			summary := &secrettemplate.Summary{Patched: 1}
+			if err := sendNotification(ts.URL, false, summary, nil); err != nil {
+				t.Fatal(err)
+			}
+			if got["cluster"] != "https://api.example.com" {
+				t.Errorf("cluster = %v", got["cluster"])
+			}
+			if c, _ := got["context"].(string); c != tt.wantContext {
+				t.Errorf("context = %v, want %q", c, tt.wantContext)
+			}
+			if want := tt.wantText + summary.String(); got["text"] != want {
+				t.Errorf("text = %v, want %q", got["text"], want)
+			}
+		})
+	}
+}
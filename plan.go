@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// planVersion is the version of the plan file format
+const planVersion = 1
+
+// plan is the file written by --write-plan and executed by --apply-plan
+type plan struct {
+	Version     int             `json:"version"`
+	Time        time.Time       `json:"time"`
+	IncludeData bool            `json:"includeData"`
+	Secrets     []plannedSecret `json:"secrets"`
+}
+
+// plannedSecret is a secret to create or patch, with the merged metadata to send and the
+// resourceVersion of the live secret the plan was computed against
+type plannedSecret struct {
+	Secret          *corev1.Secret        `json:"secret"`
+	Change          secrettemplate.Change `json:"change"`
+	ResourceVersion string                `json:"resourceVersion,omitempty"`
+}
+
+// newPlan returns the plan of the changes, the data of the merged secrets only kept if
+// includeData is set
+func newPlan(secrets []*corev1.Secret, existing []corev1.Secret, changes []secrettemplate.Change, includeData bool) *plan {
+	p := &plan{Version: planVersion, Time: time.Now().UTC(), IncludeData: includeData}
+	for _, s := range secrets {
+		c := secrettemplate.FindChange(s, changes)
+		if c == nil {
+			continue
+		}
+		ps := plannedSecret{
+			Secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        s.Name,
+					Namespace:   s.Namespace,
+					Annotations: s.Annotations,
+					Labels:      s.Labels,
+				},
+				Type: s.Type,
+			},
+			Change: *c,
+		}
+		if includeData || c.Create {
+			ps.Secret.Data = s.Data
+			ps.Secret.StringData = s.StringData
+		}
+		for _, rs := range existing {
+			if rs.Namespace == s.Namespace && rs.Name == s.Name {
+				ps.ResourceVersion = rs.ResourceVersion
+				break
+			}
+		}
+		p.Secrets = append(p.Secrets, ps)
+	}
+	return p
+}
+
+// writePlan writes the plan as JSON to path. The file holds secret data when data is
+// included or secrets are created, so it is only readable by its owner.
+func writePlan(path string, p *plan) error {
+	l := log.WithFields(log.Fields{
+		"action":  "writePlan",
+		"path":    path,
+		"secrets": len(p.Secrets),
+	})
+	l.Print("writePlan")
+	jd, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(jd, '\n'), 0600)
+}
+
+// readPlan reads a plan file written by writePlan
+func readPlan(path string) (*plan, error) {
+	fd, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &plan{}
+	if err := json.Unmarshal(fd, p); err != nil {
+		return nil, fmt.Errorf("plan %s: %w", path, err)
+	}
+	if p.Version != planVersion {
+		return nil, fmt.Errorf("plan %s has version %d, expected %d", path, p.Version, planVersion)
+	}
+	return p, nil
+}
+
+// applyPlan creates and patches exactly the secrets of the plan file, without reading the
+// templates or recomputing the changes. Secrets modified since the plan was written, or
+// created or deleted since, are logged as warnings and still applied, the changed keys of
+// a modified secret on top of its live metadata. --max-changes,
+// --dump, --dry-run and --dry-run-server apply to the plan as they do to a normal run.
+func applyPlan(ctx context.Context, cfg *config) (*secrettemplate.Summary, error) {
+	l := log.WithFields(log.Fields{
+		"action": "applyPlan",
+		"path":   cfg.ApplyPlan,
+	})
+	p, err := readPlan(cfg.ApplyPlan)
+	if err != nil {
+		return &secrettemplate.Summary{}, err
+	}
+	l.Printf("plan of %s: %d secrets", p.Time.Format(time.RFC3339), len(p.Secrets))
+	secrets := make([]*corev1.Secret, 0, len(p.Secrets))
+	changes := make([]secrettemplate.Change, 0, len(p.Secrets))
+	var existing []corev1.Secret
+	for _, ps := range p.Secrets {
+		live, err := k8sClient.CoreV1().Secrets(ps.Secret.Namespace).Get(ctx, ps.Secret.Name, metav1.GetOptions{})
+		if err == nil {
+			existing = append(existing, *live)
+		}
+		switch {
+		case err != nil && !ps.Change.Create:
+			l.Warnf("secret %s/%s: %v", ps.Secret.Namespace, ps.Secret.Name, secrettemplate.ClassifyAPIError(err))
+		case err == nil && ps.Change.Create:
+			l.Warnf("secret %s/%s was created since the plan", ps.Secret.Namespace, ps.Secret.Name)
+		case err == nil && live.ResourceVersion != ps.ResourceVersion:
+			l.Warnf("secret %s/%s changed since the plan, resourceVersion %s is now %s", ps.Secret.Namespace, ps.Secret.Name, ps.ResourceVersion, live.ResourceVersion)
+		}
+		// the patch is preconditioned on the planned secret, so keys another writer changed
+		// since are rebased rather than overwritten with their planned values
+		ps.Secret.ResourceVersion = ps.ResourceVersion
+		secrets = append(secrets, ps.Secret)
+		changes = append(changes, ps.Change)
+	}
+	if cfg.MaxChanges >= 0 && len(changes) > cfg.MaxChanges {
+		return &secrettemplate.Summary{Changes: len(changes)}, fmt.Errorf("%d secrets would change, exceeding --max-changes=%d", len(changes), cfg.MaxChanges)
+	}
+	if cfg.DumpEffectiveSecrets {
+		return &secrettemplate.Summary{Changes: len(changes), Skipped: len(secrets)}, writeEffectiveSecrets(os.Stdout, secrets, cfg.ShowData)
+	}
+	if cfg.DryRun {
+		summary := &secrettemplate.Summary{Changes: len(changes)}
+		if cfg.Output == "diff" {
+			return summary, writeDiff(os.Stdout, secrets, existing, changes, diffOptions{
+				Context:       cfg.DiffContext,
+				ShowUnchanged: cfg.ShowUnchanged,
+			})
+		}
+		return summary, writePreview(os.Stdout, cfg.Output, secrets, changes)
+	}
+	popts := cfg.patchOptions()
+	popts.IncludeData = p.IncludeData
+	if cfg.DryRunServer {
+		l.Print("server-side dry run, no secret is changed")
+		popts.ServerDryRun, popts.Verify, popts.Transactional, popts.Atomic = true, false, false, false
+	}
+	summary, err := secrettemplate.UpdateK8sSecretsMetadata(ctx, k8sClient, secrets, changes, popts)
+	summary.Changes = len(changes)
+	if cfg.AuditLog != "" && !cfg.DryRunServer {
+		if aerr := writeAuditLog(cfg.AuditLog, cfg.AuditLogMaxSize, auditEntries(summary.Results, secrets, existing, currentActor(cfg))); aerr != nil {
+			l.Errorf("failed to write audit log: %v", aerr)
+			if err == nil {
+				err = fmt.Errorf("audit log %s: %w", cfg.AuditLog, aerr)
+			}
+		}
+	}
+	return summary, err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// enforceResourceVersion makes the fake cluster fail patches preconditioned on a stale
+// resourceVersion with a conflict, as the API server does
+func enforceResourceVersion(client *fake.Clientset) {
+	client.PrependReactor("patch", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pa := action.(k8stesting.PatchAction)
+		var patch struct {
+			Metadata struct {
+				ResourceVersion string `json:"resourceVersion"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(pa.GetPatch(), &patch); err != nil {
+			return true, nil, err
+		}
+		obj, err := client.Tracker().Get(schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, pa.GetNamespace(), pa.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		if rv := patch.Metadata.ResourceVersion; rv != "" && rv != obj.(*corev1.Secret).ResourceVersion {
+			return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "secrets"}, pa.GetName(), errors.New("the object has been modified"))
+		}
+		return false, nil, nil
+	})
+}
+
+func TestApplyPlanSecretChangedSincePlan(t *testing.T) {
+	listed := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       "default",
+		Name:            "app",
+		ResourceVersion: "1",
+		Annotations:     map[string]string{"owner": "team-a", "other": "listed"},
+	}}
+	tests := []struct {
+		name string
+		edit func(s *corev1.Secret)
+		want map[string]string
+	}{
+		{
+			name: "unchanged since the plan",
+			want: map[string]string{"owner": "team-b", "other": "listed"},
+		},
+		{
+			name: "another writer changed a key the plan does not change",
+			edit: func(s *corev1.Secret) { s.Annotations["other"] = "changed" },
+			want: map[string]string{"owner": "team-b", "other": "changed"},
+		},
+		{
+			name: "another writer added a key",
+			edit: func(s *corev1.Secret) { s.Annotations["new"] = "x" },
+			want: map[string]string{"owner": "team-b", "other": "listed", "new": "x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(listed.DeepCopy())
+			enforceResourceVersion(client)
+			k8sClient = client
+			template := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", Annotations: map[string]string{"owner": "team-b"}}}
+			merged, changes, err := secrettemplate.MergeSecrets([]*corev1.Secret{template}, []corev1.Secret{*listed}, secrettemplate.MergeOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "plan.json")
+			if err := writePlan(path, newPlan(merged, []corev1.Secret{*listed}, changes, false)); err != nil {
+				t.Fatal(err)
+			}
+			if tt.edit != nil {
+				live := listed.DeepCopy()
+				tt.edit(live)
+				live.ResourceVersion = "2"
+				if _, err := client.CoreV1().Secrets("default").Update(context.Background(), live, metav1.UpdateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg, err := parseFlags([]string{"--apply-plan", path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			summary, err := applyPlan(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.Patched != 1 {
+				t.Errorf("patched = %d, want 1", summary.Patched)
+			}
+			got, err := client.CoreV1().Secrets("default").Get(context.Background(), "app", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Annotations, tt.want) {
+				t.Errorf("annotations = %v, want %v", got.Annotations, tt.want)
+			}
+		})
+	}
+}
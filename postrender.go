@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// postRenderSource pipes each document of src through the --post-renderer command,
+// yielding the command's output in place of the document
+type postRenderSource struct {
+	src     secrettemplate.Source
+	command []string
+}
+
+// Documents returns the post-rendered documents of the source, keeping their names
+func (s postRenderSource) Documents() ([]secrettemplate.Document, error) {
+	l := log.WithFields(log.Fields{
+		"action":  "postRender",
+		"command": s.command[0],
+	})
+	docs, err := s.src.Documents()
+	if err != nil {
+		return nil, err
+	}
+	rendered := make([]secrettemplate.Document, 0, len(docs))
+	for _, d := range docs {
+		l.Printf("post-render document: %s", d.Name)
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(s.command[0], s.command[1:]...)
+		cmd.Stdin = strings.NewReader(d.Content)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				err = fmt.Errorf("%w: %s", err, msg)
+			}
+			return nil, fmt.Errorf("post-renderer %s on %s: %w", s.command[0], d.Name, err)
+		}
+		rendered = append(rendered, secrettemplate.Document{Name: d.Name, Content: stdout.String()})
+	}
+	return rendered, nil
+}
+
+// parseSource parses the templates of src, post-rendered by --post-renderer if set
+func parseSource(src secrettemplate.Source, cfg *config, opts secrettemplate.ParseOptions) ([]*corev1.Secret, error) {
+	if command := strings.Fields(cfg.PostRenderer); len(command) > 0 {
+		src = postRenderSource{src: src, command: command}
+	}
+	return secrettemplate.ParseSource(src, opts)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// changeAction returns the dry run action of a change, create or patch
+func changeAction(c *secrettemplate.Change) string {
+	if c.Create {
+		return "create"
+	}
+	return "patch"
+}
+
+// previewSecrets returns the metadata-only form of the secrets that would be created or
+// patched. Secrets that would be created also carry their type.
+func previewSecrets(secrets []*corev1.Secret, changes []secrettemplate.Change) []corev1.Secret {
+	var ps []corev1.Secret
+	for _, s := range secrets {
+		c := secrettemplate.FindChange(s, changes)
+		if c == nil {
+			continue
+		}
+		p := corev1.Secret{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "v1",
+				Kind:       "Secret",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        s.Name,
+				Namespace:   s.Namespace,
+				Annotations: s.Annotations,
+				Labels:      s.Labels,
+			},
+		}
+		if c.Create {
+			p.Type = s.Type
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// writePreview writes the changes a dry run would make to w in the given format
+func writePreview(w io.Writer, format string, secrets []*corev1.Secret, changes []secrettemplate.Change) error {
+	switch format {
+	case "", "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ACTION\tNAMESPACE\tNAME\tANNOTATIONS\tLABELS\tDATA")
+		for i := range changes {
+			c := &changes[i]
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", changeAction(c), c.Namespace, c.Name, secrettemplate.JoinOrDash(c.Annotations, c.RemoveAnnotations), secrettemplate.JoinOrDash(c.Labels, c.RemoveLabels), secrettemplate.JoinOrDash(c.Data, nil))
+		}
+		return tw.Flush()
+	case "json":
+		jd, err := json.MarshalIndent(previewSecrets(secrets, changes), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(jd))
+		return err
+	case "yaml":
+		for _, s := range previewSecrets(secrets, changes) {
+			yd, err := yaml.Marshal(s)
+			if err != nil {
+				return err
+			}
+			action := changeAction(secrettemplate.FindChange(&s, changes))
+			if _, err := fmt.Fprintf(w, "---\n# action: %s\n%s", action, yd); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected table, yaml or json", format)
+}
+
+// writeEffectiveSecrets writes every merged secret as YAML to w, with the data omitted
+// unless showData is set
+func writeEffectiveSecrets(w io.Writer, secrets []*corev1.Secret, showData bool) error {
+	for _, s := range secrets {
+		es := corev1.Secret{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "v1",
+				Kind:       "Secret",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        s.Name,
+				Namespace:   s.Namespace,
+				Annotations: s.Annotations,
+				Labels:      s.Labels,
+			},
+			Type: s.Type,
+		}
+		if showData {
+			es.Data = secrettemplate.SecretData(s)
+		}
+		yd, err := yaml.Marshal(es)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", yd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// rbacName is the name of the generated roles and bindings
+const rbacName = "k8s-secret-template"
+
+// rbacRules returns the policy rules the configured mode needs within the namespaces it
+// reconciles
+func rbacRules(cfg *config) []rbacv1.PolicyRule {
+	verbs := []string{"get", "list"}
+	if !cfg.DryRun && !cfg.DumpEffectiveSecrets {
+		verbs = append(verbs, "patch")
+		if cfg.CreateMissing {
+			verbs = append(verbs, "create")
+		}
+	}
+	if cfg.Incremental || cfg.WatchSecrets {
+		verbs = append(verbs, "watch")
+	}
+	rules := []rbacv1.PolicyRule{{
+		APIGroups: []string{""},
+		Resources: []string{"secrets"},
+		Verbs:     verbs,
+	}}
+	if cfg.NamespaceSource != namespaceSourceTemplates {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"namespaces"},
+			Verbs:     []string{"list"},
+		})
+	}
+	return rules
+}
+
+// rbacClusterWide returns true if the configured mode reads secrets or namespaces across
+// the cluster, needing a ClusterRole
+func rbacClusterWide(cfg *config) bool {
+	return cfg.NamespaceSource != namespaceSourceTemplates || cfg.NameAllNamespaces
+}
+
+// writeRBAC writes the Roles, or ClusterRole, and bindings the configured mode needs for
+// the service account as YAML to w, reading only the local templates
+func writeRBAC(w io.Writer, cfg *config) error {
+	sans, san, err := splitNamespacedName(cfg.RBACServiceAccount)
+	if err != nil {
+		return fmt.Errorf("--rbac-service-account: %w", err)
+	}
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: san, Namespace: sans}}
+	var objects []interface{}
+	// namespaces maps the namespaces needing a Role to whether templates apply in them
+	namespaces := map[string]bool{}
+	if rbacClusterWide(cfg) {
+		objects = append(objects,
+			&rbacv1.ClusterRole{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+				ObjectMeta: metav1.ObjectMeta{Name: rbacName},
+				Rules:      rbacRules(cfg),
+			},
+			&rbacv1.ClusterRoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+				ObjectMeta: metav1.ObjectMeta{Name: rbacName},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: rbacName},
+				Subjects:   subjects,
+			})
+	} else {
+		sec, err := loadTemplates(cfg)
+		if err != nil {
+			return err
+		}
+		if sec, err = secrettemplate.ExpandNamespaces(sec, cfg.EnableTemplating, cfg.values); err != nil {
+			return err
+		}
+		sec = applyDefaultNamespace(sec, resolveDefaultNamespace(cfg.DefaultNamespace))
+		sec = secrettemplate.ReplicateNamespaces(sec, cfg.replicateNamespaces())
+		for _, s := range sec {
+			if s.Namespace != "" {
+				namespaces[s.Namespace] = true
+			}
+		}
+	}
+	// the status ConfigMap is always namespaced
+	statusNs := ""
+	if cfg.StatusConfigMap != "" {
+		statusNs, _, err = splitNamespacedName(cfg.StatusConfigMap)
+		if err != nil {
+			return fmt.Errorf("--status-configmap: %w", err)
+		}
+		if _, ok := namespaces[statusNs]; !ok {
+			namespaces[statusNs] = false
+		}
+	}
+	// the kubeconfig secret is read with the host cluster's credentials
+	var kubeconfigNs, kubeconfigName string
+	if cfg.KubeconfigFromSecret != "" {
+		kubeconfigNs, kubeconfigName, err = splitNamespacedName(cfg.KubeconfigFromSecret)
+		if err != nil {
+			return fmt.Errorf("--kubeconfig-from-secret: %w", err)
+		}
+		if _, ok := namespaces[kubeconfigNs]; !ok {
+			namespaces[kubeconfigNs] = false
+		}
+	}
+	// copy-data sources are read in their namespaces
+	sources := map[string]bool{}
+	if cfg.IncludeData && !rbacClusterWide(cfg) {
+		for _, ns := range cfg.CopyDataNamespaces {
+			sources[ns] = true
+			if _, ok := namespaces[ns]; !ok {
+				namespaces[ns] = false
+			}
+		}
+	}
+	var sorted []string
+	for ns := range namespaces {
+		sorted = append(sorted, ns)
+	}
+	sort.Strings(sorted)
+	for _, ns := range sorted {
+		var rules []rbacv1.PolicyRule
+		if namespaces[ns] {
+			rules = rbacRules(cfg)
+		} else if sources[ns] {
+			rules = append(rules, rbacv1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"secrets"},
+				Verbs:     []string{"get"},
+			})
+		}
+		if ns == statusNs && cfg.StatusConfigMap != "" {
+			rules = append(rules, rbacv1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"configmaps"},
+				Verbs:     []string{"get", "create", "update"},
+			})
+		}
+		if ns == kubeconfigNs && kubeconfigName != "" && !namespaces[ns] {
+			rules = append(rules, rbacv1.PolicyRule{
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				Verbs:         []string{"get"},
+				ResourceNames: []string{kubeconfigName},
+			})
+		}
+		if len(rules) == 0 {
+			continue
+		}
+		objects = append(objects,
+			&rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+				ObjectMeta: metav1.ObjectMeta{Name: rbacName, Namespace: ns},
+				Rules:      rules,
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+				ObjectMeta: metav1.ObjectMeta{Name: rbacName, Namespace: ns},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: rbacName},
+				Subjects:   subjects,
+			})
+	}
+	for _, o := range objects {
+		yd, err := yaml.Marshal(o)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", yd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// rbacRoles returns the rules of the Roles in the --print-rbac output by namespace
+func rbacRoles(t *testing.T, out string) map[string][]rbacv1.PolicyRule {
+	t.Helper()
+	roles := map[string][]rbacv1.PolicyRule{}
+	for _, doc := range strings.Split(out, "---\n") {
+		var r rbacv1.Role
+		if err := yaml.Unmarshal([]byte(doc), &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Kind == "Role" {
+			roles[r.Namespace] = r.Rules
+		}
+	}
+	return roles
+}
+
+func TestWriteRBACKubeconfigFromSecret(t *testing.T) {
+	kubeconfigRule := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}, ResourceNames: []string{"target"}}
+	tests := []struct {
+		name string
+		args []string
+		want map[string][]rbacv1.PolicyRule
+	}{
+		{
+			name: "without the flag",
+			args: []string{"--namespace-source", "all"},
+			want: map[string][]rbacv1.PolicyRule{},
+		},
+		{
+			name: "secret in its own namespace",
+			args: []string{"--namespace-source", "all", "--kubeconfig-from-secret", "infra/target"},
+			want: map[string][]rbacv1.PolicyRule{"infra": {kubeconfigRule}},
+		},
+		{
+			name: "secret next to the status configmap",
+			args: []string{"--namespace-source", "all", "--kubeconfig-from-secret", "infra/target", "--status-configmap", "infra/status"},
+			want: map[string][]rbacv1.PolicyRule{"infra": {
+				{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "create", "update"}},
+				kubeconfigRule,
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseFlags(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err := writeRBAC(&out, cfg); err != nil {
+				t.Fatal(err)
+			}
+			if got := rbacRoles(t, out.String()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("roles = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	cfg, err := parseFlags([]string{"--namespace-source", "all", "--kubeconfig-from-secret", "target"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeRBAC(&bytes.Buffer{}, cfg); err == nil || !strings.Contains(err.Error(), "--kubeconfig-from-secret") {
+		t.Errorf("err = %v, want an invalid --kubeconfig-from-secret", err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+)
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds a test case per processed secret
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is the outcome of a single secret
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+// junitFailure marks a failed test case
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitReport returns the run outcome as JUnit test suites, with a test case per secret
+// named after it and classed by its namespace. Patched, created and skipped secrets pass
+// and errored ones fail. Namespaces in summary.EmptyNamespaces pass as a test case named
+// namespace. A run error is reported as a failed test case of its own.
+func junitReport(summary *secrettemplate.Summary, runErr error, start time.Time, d time.Duration) junitTestSuites {
+	ts := junitTestSuite{
+		Name:      "k8s-secret-template",
+		Time:      fmt.Sprintf("%.3f", d.Seconds()),
+		Timestamp: start.UTC().Format(time.RFC3339),
+	}
+	for _, r := range summary.Results {
+		tc := junitTestCase{ClassName: r.Namespace, Name: r.Name, SystemOut: r.Action}
+		if r.Change != nil && r.Action != secrettemplate.ActionError {
+			tc.SystemOut = fmt.Sprintf("%s %s", r.Action, r.Change)
+		}
+		if r.Action == secrettemplate.ActionError {
+			tc.Failure = &junitFailure{Message: r.Error, Text: r.Error}
+		}
+		ts.Cases = append(ts.Cases, tc)
+	}
+	for _, ns := range summary.EmptyNamespaces {
+		ts.Cases = append(ts.Cases, junitTestCase{ClassName: ns, Name: "namespace", SystemOut: "checked, no matching secrets"})
+	}
+	if runErr != nil {
+		ts.Cases = append(ts.Cases, junitTestCase{
+			ClassName: "k8s-secret-template",
+			Name:      "run",
+			Failure:   &junitFailure{Message: runErr.Error(), Text: runErr.Error()},
+		})
+	}
+	for _, tc := range ts.Cases {
+		if tc.Failure != nil {
+			ts.Failures++
+		}
+	}
+	ts.Tests = len(ts.Cases)
+	return junitTestSuites{Suites: []junitTestSuite{ts}}
+}
+
+// writeReport writes the run outcome to path in the --report-format
+func writeReport(path string, format string, summary *secrettemplate.Summary, runErr error, start time.Time, d time.Duration) error {
+	l := log.WithFields(log.Fields{
+		"action": "writeReport",
+		"path":   path,
+		"format": format,
+	})
+	l.Print("writeReport")
+	b, err := xml.MarshalIndent(junitReport(summary, runErr, start, d), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(b, '\n')...), 0644)
+}
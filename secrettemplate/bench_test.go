@@ -0,0 +1,62 @@
+package secrettemplate
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// benchSecrets returns n templates, one per existing secret spread over 50 namespaces, and
+// the existing secrets with half of the template annotations already set
+func benchSecrets(n int) ([]*corev1.Secret, []corev1.Secret) {
+	templates := make([]*corev1.Secret, n)
+	existing := make([]corev1.Secret, n)
+	for i := 0; i < n; i++ {
+		ns, name := fmt.Sprintf("ns-%d", i%50), fmt.Sprintf("secret-%d", i)
+		templates[i] = metaSecret(ns, name,
+			map[string]string{"owner": "team-a", "example.com/build": fmt.Sprint(i)},
+			map[string]string{"tier": "web"})
+		existing[i] = *metaSecret(ns, name,
+			map[string]string{"owner": "team-a", "example.com/unmanaged": "x"},
+			map[string]string{"app": name})
+	}
+	return templates, existing
+}
+
+// quietBenchmark discards the log output for the duration of the benchmark
+func quietBenchmark(b *testing.B) {
+	out := log.StandardLogger().Out
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(out) })
+}
+
+func BenchmarkComputeChanges(b *testing.B) {
+	quietBenchmark(b)
+	for _, n := range []int{100, 1000, 5000} {
+		templates, existing := benchSecrets(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := ComputeChanges(templates, existing, MergeOptions{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUpdateSecretMetadata(b *testing.B) {
+	quietBenchmark(b)
+	for _, n := range []int{100, 1000, 5000} {
+		templates, existing := benchSecrets(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := UpdateSecretMetadata(templates, existing, MergeOptions{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package secrettemplate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+)
+
+// Change describes the metadata keys a template will change on an existing secret
+type Change struct {
+	Namespace   string
+	Name        string
+	Annotations []string
+	Labels      []string
+	Data        []string
+	// RemoveAnnotations and RemoveLabels are the managed keys dropped in replace mode
+	RemoveAnnotations []string
+	RemoveLabels      []string
+	// Create is set when the secret does not exist and will be created from the template
+	Create bool
+}
+
+// MergeOptions controls how template metadata is merged into existing secrets
+type MergeOptions struct {
+	IncludeData bool
+	// Replace removes existing keys under ManagementPrefix that the template no longer
+	// defines, other than the annotation and label keys of NeverRemove
+	Replace          bool
+	ManagementPrefix string
+	NeverRemove      []string
+	// CreateMissing creates secrets for name matched templates without an existing secret
+	CreateMissing bool
+	// Templating renders annotation and label values against the matched secret
+	Templating bool
+	// OnlyIfMissing skips existing secrets which already have this annotation key set
+	OnlyIfMissing string
+	// MergeStrategy is MergeReplace or MergeDeep, defaulting to MergeReplace
+	MergeStrategy string
+	// ListAnnotations maps the keys of list valued annotations to their separator. Their
+	// template values are unioned with the existing values regardless of MergeStrategy.
+	ListAnnotations map[string]string
+	// Values are available to value templates as .Values
+	Values map[string]interface{}
+	// Annotations are extra annotations per namespace/name of the matched secret, taking
+	// precedence over the template's
+	Annotations map[string]map[string]string
+	// LabelMappings derive annotations from the labels of the matched secret
+	LabelMappings []LabelMapping
+	// Checksum adds the ChecksumAnnotation of the desired metadata to every secret
+	Checksum bool
+	// StrictMetadata fails on annotations and labels the API server would reject instead
+	// of skipping them
+	StrictMetadata bool
+}
+
+// changedKeys returns the sorted keys in desired whose value differs from current
+func changedKeys(current map[string]string, desired map[string]string) []string {
+	var keys []string
+	for _, k := range SortedKeys(desired) {
+		if cv, ok := current[k]; !ok || cv != desired[k] {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// removedKeys returns the sorted keys in current under prefix which are not in desired.
+// The pin annotation is owned by the secret and never removed, nor are the keys of keep.
+func removedKeys(current map[string]string, desired map[string]string, prefix string, keep []string) []string {
+	var keys []string
+keysLoop:
+	for _, k := range SortedKeys(current) {
+		if !strings.HasPrefix(k, prefix) || k == PinVersionAnnotation {
+			continue
+		}
+		for _, kk := range keep {
+			if k == kk {
+				continue keysLoop
+			}
+		}
+		if _, ok := desired[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// ComputeChanges returns the existing secrets whose metadata, and data if opts.IncludeData
+// is set, would be changed by the new secrets
+func ComputeChanges(newSecrets []*corev1.Secret, existingSecrets []corev1.Secret, opts MergeOptions) ([]Change, error) {
+	var changes []Change
+	for _, ls := range newSecrets {
+		matches := MatchingSecrets(ls, existingSecrets)
+		if len(matches) == 0 && opts.CreateMissing && IsNameTemplate(ls) {
+			ta, tl, err := desiredMetadata(ls, ls, opts)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{
+				Namespace:   ls.Namespace,
+				Name:        ls.Name,
+				Annotations: SortedKeys(ta),
+				Labels:      SortedKeys(tl),
+				Data:        sortedDataKeys(SecretData(ls)),
+				Create:      true,
+			})
+			continue
+		}
+		matches, _ = skipProcessed(skipPinned(ls, matches), opts.OnlyIfMissing)
+		for _, rs := range matches {
+			ta, tl, err := desiredMetadata(ls, &rs, opts)
+			if err != nil {
+				return nil, err
+			}
+			c := Change{
+				Namespace:   rs.Namespace,
+				Name:        rs.Name,
+				Annotations: changedKeys(rs.Annotations, ta),
+				Labels:      changedKeys(rs.Labels, tl),
+			}
+			if opts.IncludeData {
+				c.Data = changedDataKeys(rs.Data, SecretData(ls))
+			}
+			if opts.Replace {
+				c.RemoveAnnotations = removedKeys(rs.Annotations, ta, opts.ManagementPrefix, opts.NeverRemove)
+				c.RemoveLabels = removedKeys(rs.Labels, tl, opts.ManagementPrefix, opts.NeverRemove)
+			}
+			// the size is warned about once by UpdateSecretMetadata, here it only skips
+			if opts.StrictMetadata && annotationsSize(mergedAnnotations(rs.Annotations, ta, c.RemoveAnnotations)) > apivalidation.TotalAnnotationSizeLimitB {
+				continue
+			}
+			if len(c.Annotations) > 0 || len(c.Labels) > 0 || len(c.Data) > 0 ||
+				len(c.RemoveAnnotations) > 0 || len(c.RemoveLabels) > 0 {
+				changes = append(changes, c)
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Namespace != changes[j].Namespace {
+			return changes[i].Namespace < changes[j].Namespace
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes, nil
+}
+
+// skipProcessed returns the secrets which do not have the annotation key set, and the
+// number of secrets dropped as already processed. An empty key keeps every secret.
+func skipProcessed(secrets []corev1.Secret, key string) ([]corev1.Secret, int) {
+	if key == "" {
+		return secrets, 0
+	}
+	var kept []corev1.Secret
+	for _, s := range secrets {
+		if _, ok := s.Annotations[key]; ok {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return kept, len(secrets) - len(kept)
+}
+
+// String renders the changed and removed keys, removed keys prefixed with "-"
+func (c *Change) String() string {
+	return fmt.Sprintf("annotations=%s labels=%s data=%s",
+		JoinOrDash(c.Annotations, c.RemoveAnnotations), JoinOrDash(c.Labels, c.RemoveLabels), JoinOrDash(c.Data, nil))
+}
+
+// FindChange returns the change computed for the secret, or nil if it is unchanged
+func FindChange(secret *corev1.Secret, changes []Change) *Change {
+	for i, c := range changes {
+		if c.Namespace == secret.Namespace && c.Name == secret.Name {
+			return &changes[i]
+		}
+	}
+	return nil
+}
+
+// JoinOrDash joins keys, and removed keys prefixed with "-", with commas, returning "-"
+// when there are none
+func JoinOrDash(keys []string, removed []string) string {
+	all := append([]string{}, keys...)
+	for _, k := range removed {
+		all = append(all, "-"+k)
+	}
+	if len(all) == 0 {
+		return "-"
+	}
+	return strings.Join(all, ",")
+}
@@ -0,0 +1,167 @@
+package secrettemplate
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// applyRun merges the templates into the existing secrets and patches the result into a
+// fake cluster holding them, returning the secrets as they are afterwards
+func applyRun(t *testing.T, templates []*corev1.Secret, existing []corev1.Secret, opts MergeOptions) map[string]*corev1.Secret {
+	t.Helper()
+	objects := make([]runtime.Object, len(existing))
+	for i := range existing {
+		objects[i] = existing[i].DeepCopy()
+	}
+	client := fake.NewSimpleClientset(objects...)
+	merged, changes, err := MergeSecrets(templates, existing, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UpdateK8sSecretsMetadata(context.Background(), client, merged, changes, PatchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := client.CoreV1().Secrets("").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := make(map[string]*corev1.Secret, len(list.Items))
+	for i := range list.Items {
+		secrets[list.Items[i].Namespace+"/"+list.Items[i].Name] = &list.Items[i]
+	}
+	return secrets
+}
+
+// metaSecret returns a secret with the annotations and labels
+func metaSecret(ns, name string, annotations, labels map[string]string) *corev1.Secret {
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name, Annotations: annotations, Labels: labels}}
+}
+
+func TestReplaceModeKeepsForeignKeys(t *testing.T) {
+	existing := []corev1.Secret{*metaSecret("default", "app",
+		map[string]string{
+			"cert-manager.io/issuer-name":   "letsencrypt",
+			"k8s-secret-template/owner":     "team-a",
+			"k8s-secret-template/stale":     "true",
+			"example.com/unmanaged-comment": "hi",
+		},
+		map[string]string{
+			"app":                     "web",
+			"k8s-secret-template/old": "true",
+		})}
+	template := metaSecret("default", "app",
+		map[string]string{"k8s-secret-template/owner": "team-b"},
+		map[string]string{"k8s-secret-template/tier": "gold"})
+	tests := []struct {
+		name            string
+		opts            MergeOptions
+		wantAnnotations map[string]string
+		wantLabels      map[string]string
+	}{
+		{
+			name: "merge mode removes nothing",
+			opts: MergeOptions{ManagementPrefix: "k8s-secret-template/"},
+			wantAnnotations: map[string]string{
+				"cert-manager.io/issuer-name":   "letsencrypt",
+				"k8s-secret-template/owner":     "team-b",
+				"k8s-secret-template/stale":     "true",
+				"example.com/unmanaged-comment": "hi",
+			},
+			wantLabels: map[string]string{"app": "web", "k8s-secret-template/old": "true", "k8s-secret-template/tier": "gold"},
+		},
+		{
+			name: "replace mode removes only keys under the prefix",
+			opts: MergeOptions{Replace: true, ManagementPrefix: "k8s-secret-template/"},
+			wantAnnotations: map[string]string{
+				"cert-manager.io/issuer-name":   "letsencrypt",
+				"k8s-secret-template/owner":     "team-b",
+				"example.com/unmanaged-comment": "hi",
+			},
+			wantLabels: map[string]string{"app": "web", "k8s-secret-template/tier": "gold"},
+		},
+		{
+			name: "a different prefix leaves the keys alone",
+			opts: MergeOptions{Replace: true, ManagementPrefix: "example.org/"},
+			wantAnnotations: map[string]string{
+				"cert-manager.io/issuer-name":   "letsencrypt",
+				"k8s-secret-template/owner":     "team-b",
+				"k8s-secret-template/stale":     "true",
+				"example.com/unmanaged-comment": "hi",
+			},
+			wantLabels: map[string]string{"app": "web", "k8s-secret-template/old": "true", "k8s-secret-template/tier": "gold"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := applyRun(t, []*corev1.Secret{template.DeepCopy()}, existing, tt.opts)["default/app"]
+			if !reflect.DeepEqual(got.Annotations, tt.wantAnnotations) {
+				t.Errorf("annotations = %v, want %v", got.Annotations, tt.wantAnnotations)
+			}
+			if !reflect.DeepEqual(got.Labels, tt.wantLabels) {
+				t.Errorf("labels = %v, want %v", got.Labels, tt.wantLabels)
+			}
+		})
+	}
+}
+
+func TestReplaceModeNeverRemove(t *testing.T) {
+	existing := []corev1.Secret{*metaSecret("default", "app",
+		map[string]string{
+			"k8s-secret-template/bootstrapped": "2026-01-01",
+			"k8s-secret-template/stale":        "true",
+		},
+		map[string]string{
+			"k8s-secret-template/bootstrapped": "true",
+			"k8s-secret-template/old":          "true",
+		})}
+	template := metaSecret("default", "app", map[string]string{"k8s-secret-template/owner": "team-b"}, nil)
+	tests := []struct {
+		name            string
+		neverRemove     []string
+		wantAnnotations map[string]string
+		wantLabels      map[string]string
+	}{
+		{
+			name:            "unprotected keys are removed",
+			wantAnnotations: map[string]string{"k8s-secret-template/owner": "team-b"},
+			wantLabels:      nil,
+		},
+		{
+			name:        "protected key survives as annotation and label",
+			neverRemove: []string{"k8s-secret-template/bootstrapped"},
+			wantAnnotations: map[string]string{
+				"k8s-secret-template/bootstrapped": "2026-01-01",
+				"k8s-secret-template/owner":        "team-b",
+			},
+			wantLabels: map[string]string{"k8s-secret-template/bootstrapped": "true"},
+		},
+		{
+			name:        "every protected key survives",
+			neverRemove: []string{"k8s-secret-template/bootstrapped", "k8s-secret-template/stale", "k8s-secret-template/old"},
+			wantAnnotations: map[string]string{
+				"k8s-secret-template/bootstrapped": "2026-01-01",
+				"k8s-secret-template/stale":        "true",
+				"k8s-secret-template/owner":        "team-b",
+			},
+			wantLabels: map[string]string{"k8s-secret-template/bootstrapped": "true", "k8s-secret-template/old": "true"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := MergeOptions{Replace: true, ManagementPrefix: "k8s-secret-template/", NeverRemove: tt.neverRemove}
+			got := applyRun(t, []*corev1.Secret{template.DeepCopy()}, existing, opts)["default/app"]
+			if !reflect.DeepEqual(got.Annotations, tt.wantAnnotations) {
+				t.Errorf("annotations = %v, want %v", got.Annotations, tt.wantAnnotations)
+			}
+			if len(got.Labels) != len(tt.wantLabels) || (len(tt.wantLabels) > 0 && !reflect.DeepEqual(got.Labels, tt.wantLabels)) {
+				t.Errorf("labels = %v, want %v", got.Labels, tt.wantLabels)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package secrettemplate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ChecksumAnnotation holds, with MergeOptions.Checksum, the checksum of the metadata and
+// data the tool last merged into the secret
+const ChecksumAnnotation = "k8s-secret-template/checksum"
+
+// checksumInput is what a secret's checksum covers: its desired metadata, the template
+// data if it is merged, and the options deciding which existing keys are removed
+type checksumInput struct {
+	Annotations      map[string]string `json:"annotations,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	Data             map[string][]byte `json:"data,omitempty"`
+	Replace          bool              `json:"replace,omitempty"`
+	ManagementPrefix string            `json:"managementPrefix,omitempty"`
+	NeverRemove      []string          `json:"neverRemove,omitempty"`
+}
+
+// secretChecksum returns the checksum of merging the template, with the desired
+// annotations and labels, into a secret
+func secretChecksum(t *corev1.Secret, a, lb map[string]string, opts MergeOptions) string {
+	in := checksumInput{Annotations: a, Labels: lb}
+	if opts.IncludeData {
+		in.Data = SecretData(t)
+	}
+	if opts.Replace {
+		in.Replace, in.ManagementPrefix, in.NeverRemove = true, opts.ManagementPrefix, opts.NeverRemove
+	}
+	h := sha256.New()
+	_ = json.NewEncoder(h).Encode(in)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// withChecksum returns a copy of the desired annotations with the ChecksumAnnotation of
+// the desired metadata. A checksum carried by the template itself, e.g. one copied from a
+// live secret, is not part of the desired metadata.
+func withChecksum(t *corev1.Secret, a, lb map[string]string, opts MergeOptions) map[string]string {
+	c := make(map[string]string, len(a)+1)
+	for k, v := range a {
+		if k != ChecksumAnnotation {
+			c[k] = v
+		}
+	}
+	c[ChecksumAnnotation] = secretChecksum(t, c, lb, opts)
+	return c
+}
+
+// SkipMatchingChecksums drops the existing secrets whose ChecksumAnnotation equals the
+// checksum of the template applying to them, as they already hold what it sets, before
+// they are merged. It returns the remaining secrets and the number dropped, and drops
+// nothing unless opts.Checksum is set. The templates must apply to one secret each, as
+// ResolveOverlaps makes them. A secret edited by another writer since it was patched keeps
+// its checksum, so such edits are only reverted by a run without the shortcut.
+func SkipMatchingChecksums(templates []*corev1.Secret, existingSecrets []corev1.Secret, opts MergeOptions) ([]corev1.Secret, int, error) {
+	if !opts.Checksum {
+		return existingSecrets, 0, nil
+	}
+	l := log.WithFields(
+		log.Fields{
+			"action": "skipMatchingChecksums",
+		})
+	unchanged := make(map[string]bool)
+	for _, t := range templates {
+		for _, rs := range MatchingSecrets(t, existingSecrets) {
+			stored, ok := rs.Annotations[ChecksumAnnotation]
+			if !ok {
+				continue
+			}
+			a, _, err := desiredMetadata(t, &rs, opts)
+			if err != nil {
+				return nil, 0, err
+			}
+			if a[ChecksumAnnotation] == stored {
+				unchanged[rs.Namespace+"/"+rs.Name] = true
+			}
+		}
+	}
+	if len(unchanged) == 0 {
+		return existingSecrets, 0, nil
+	}
+	var kept []corev1.Secret
+	for _, s := range existingSecrets {
+		if !unchanged[s.Namespace+"/"+s.Name] {
+			kept = append(kept, s)
+		}
+	}
+	l.Printf("skipped with a matching checksum: %d", len(unchanged))
+	return kept, len(unchanged), nil
+}
@@ -0,0 +1,99 @@
+package secrettemplate
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSkipMatchingChecksums(t *testing.T) {
+	tmpl := func(owner string) *corev1.Secret {
+		return metaSecret("default", "app", map[string]string{"owner": owner, "team": "{{ .Secret.Labels.team }}"}, map[string]string{"tier": "web"})
+	}
+	opts := MergeOptions{Checksum: true, Templating: true}
+	tests := []struct {
+		name     string
+		next     *corev1.Secret
+		nextOpts MergeOptions
+		edit     func(s *corev1.Secret)
+		wantSkip bool
+	}{
+		{name: "unchanged template is skipped", next: tmpl("team-a"), nextOpts: opts, wantSkip: true},
+		{name: "changed template is merged", next: tmpl("team-b"), nextOpts: opts},
+		{
+			name:     "changed merge options are merged",
+			next:     tmpl("team-a"),
+			nextOpts: MergeOptions{Checksum: true, Templating: true, Replace: true, ManagementPrefix: "k8s-secret-template/"},
+		},
+		{
+			name:     "a change of a rendered input is merged",
+			next:     tmpl("team-a"),
+			nextOpts: opts,
+			edit:     func(s *corev1.Secret) { s.Labels["team"] = "payments" },
+		},
+		{
+			name:     "an unrelated edit keeps the skip",
+			next:     tmpl("team-a"),
+			nextOpts: opts,
+			edit:     func(s *corev1.Secret) { s.Annotations["example.com/note"] = "x" },
+			wantSkip: true,
+		},
+		{name: "nothing is skipped without the option", next: tmpl("team-a"), nextOpts: MergeOptions{Templating: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := []corev1.Secret{*metaSecret("default", "app", nil, map[string]string{"team": "checkout"})}
+			after := applyRun(t, []*corev1.Secret{tmpl("team-a")}, existing, opts)["default/app"]
+			if after.Annotations[ChecksumAnnotation] == "" {
+				t.Fatalf("annotations = %v, want a checksum", after.Annotations)
+			}
+			if tt.edit != nil {
+				tt.edit(after)
+			}
+			kept, skipped, err := SkipMatchingChecksums([]*corev1.Secret{tt.next}, []corev1.Secret{*after}, tt.nextOpts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := skipped == 1 && len(kept) == 0; got != tt.wantSkip {
+				t.Errorf("skipped = %d, kept = %d, want skip %v", skipped, len(kept), tt.wantSkip)
+			}
+		})
+	}
+}
+
+func TestChecksumCreatedSecret(t *testing.T) {
+	tmpl := metaSecret("default", "app", map[string]string{"owner": "team-a"}, nil)
+	opts := MergeOptions{Checksum: true, CreateMissing: true}
+	created, ok := applyRun(t, []*corev1.Secret{tmpl}, nil, opts)["default/app"]
+	if !ok {
+		t.Fatal("secret was not created")
+	}
+	kept, skipped, err := SkipMatchingChecksums([]*corev1.Secret{tmpl}, []corev1.Secret{*created}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 1 || len(kept) != 0 {
+		t.Errorf("created secret %v was not skipped on the next run", created.Annotations)
+	}
+}
+
+func TestChecksumIgnoresCopiedChecksum(t *testing.T) {
+	plain := metaSecret("default", "app", map[string]string{"owner": "team-a"}, nil)
+	copied := metaSecret("default", "app", map[string]string{"owner": "team-a", ChecksumAnnotation: "stale"}, nil)
+	target := metaSecret("default", "app", nil, nil)
+	opts := MergeOptions{Checksum: true}
+	a, _, err := desiredMetadata(plain, target, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := desiredMetadata(copied, target, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a[ChecksumAnnotation] != b[ChecksumAnnotation] {
+		t.Errorf("checksum %q of a template carrying one differs from %q", b[ChecksumAnnotation], a[ChecksumAnnotation])
+	}
+	if plain.Annotations[ChecksumAnnotation] != "" {
+		t.Errorf("template was modified: %v", plain.Annotations)
+	}
+}
@@ -0,0 +1,98 @@
+package secrettemplate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// copyDataDirective is a template annotation naming data keys to copy into the template
+// from a source secret, as namespace/name:key[,key...]
+const copyDataDirective = "k8s-secret-template/copy-data"
+
+// dataSource is a parsed copyDataDirective
+type dataSource struct {
+	namespace string
+	name      string
+	keys      []string
+}
+
+// parseDataSource parses a namespace/name:key[,key...] copy-data directive
+func parseDataSource(v string) (dataSource, error) {
+	var ds dataSource
+	i := strings.Index(v, ":")
+	if i < 0 {
+		return ds, fmt.Errorf("invalid %s %q, expected namespace/name:key[,key...]", copyDataDirective, v)
+	}
+	ref := strings.SplitN(strings.TrimSpace(v[:i]), "/", 2)
+	if len(ref) != 2 || ref[0] == "" || ref[1] == "" {
+		return ds, fmt.Errorf("invalid %s %q, expected namespace/name:key[,key...]", copyDataDirective, v)
+	}
+	ds.namespace, ds.name = ref[0], ref[1]
+	for _, k := range strings.Split(v[i+1:], ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			ds.keys = append(ds.keys, k)
+		}
+	}
+	if len(ds.keys) == 0 {
+		return ds, fmt.Errorf("invalid %s %q, no keys", copyDataDirective, v)
+	}
+	return ds, nil
+}
+
+// CopySourceData sets the data keys the copy-data directive of each template names to
+// their values in the source secret, read once per call so that every call picks up
+// changes to the sources. Only sources in the allowed namespaces may be read. A missing
+// source secret or key, or a key the template also defines, is an error.
+func CopySourceData(ctx context.Context, client kubernetes.Interface, templates []*corev1.Secret, allowed []string) error {
+	l := log.WithFields(log.Fields{
+		"action": "copySourceData",
+	})
+	sources := map[string]*corev1.Secret{}
+	for _, t := range templates {
+		v, ok := t.Annotations[copyDataDirective]
+		if !ok {
+			continue
+		}
+		ds, err := parseDataSource(v)
+		if err != nil {
+			return fmt.Errorf("secret %s/%s: %w", t.Namespace, t.Name, err)
+		}
+		permitted := false
+		for _, ns := range allowed {
+			permitted = permitted || ns == ds.namespace
+		}
+		if !permitted {
+			return fmt.Errorf("secret %s/%s: copy-data source namespace %s is not allowed", t.Namespace, t.Name, ds.namespace)
+		}
+		ref := ds.namespace + "/" + ds.name
+		src, ok := sources[ref]
+		if !ok {
+			src, err = client.CoreV1().Secrets(ds.namespace).Get(ctx, ds.name, metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("secret %s/%s: copy-data source %s: %w", t.Namespace, t.Name, ref, ClassifyAPIError(err))
+			}
+			sources[ref] = src
+		}
+		for _, k := range ds.keys {
+			d, ok := src.Data[k]
+			if !ok {
+				return fmt.Errorf("secret %s/%s: copy-data source %s has no key %q", t.Namespace, t.Name, ref, k)
+			}
+			if _, ok := t.Data[k]; ok {
+				return fmt.Errorf("secret %s/%s: data key %q is both defined and copied from %s", t.Namespace, t.Name, k, ref)
+			}
+			if t.Data == nil {
+				t.Data = map[string][]byte{}
+			}
+			t.Data[k] = d
+		}
+		l.Printf("secret %s/%s: copied data keys %s from %s", t.Namespace, t.Name, strings.Join(ds.keys, ","), ref)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package secrettemplate
+
+import (
+	"context"
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// IsNameTemplate returns true if the template matches by name rather than a directive
+func IsNameTemplate(t *corev1.Secret) bool {
+	m, err := newMatcher(t)
+	if err != nil {
+		return false
+	}
+	_, ok := m.(nameMatcher)
+	return ok
+}
+
+// CreateSecret creates the template as a new secret. If another writer, such as a
+// concurrent replica, creates the secret first, it falls back to patching the template
+// metadata into the now existing secret and returns created=false.
+func CreateSecret(ctx context.Context, client kubernetes.Interface, secret *corev1.Secret, opts PatchOptions) (bool, error) {
+	l := log.WithFields(
+		log.Fields{
+			"action": "createSecret",
+			"secret": secret.Namespace + "/" + secret.Name,
+		},
+	)
+	l.Print("createSecret")
+	ns := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        secret.Name,
+			Namespace:   secret.Namespace,
+			Annotations: TemplateAnnotations(secret),
+			Labels:      secret.Labels,
+		},
+		Type: secret.Type,
+		Data: SecretData(secret),
+	}
+	_, err := client.CoreV1().Secrets(secret.Namespace).Create(ctx, ns, metav1.CreateOptions{FieldManager: opts.fieldManager(), DryRun: opts.dryRun()})
+	err = ClassifyAPIError(err)
+	if errors.Is(err, ErrAlreadyExists) {
+		l.Print("secret already exists, patching instead")
+		return false, PatchSecretMetadata(ctx, client, ns, &Change{}, opts)
+	} else if err != nil {
+		l.Printf("create error: %v", err)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,73 @@
+package secrettemplate
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCreateSecretAlreadyExists(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     PatchOptions
+		wantData map[string]interface{}
+	}{
+		{name: "metadata only"},
+		{name: "with data", opts: PatchOptions{IncludeData: true}, wantData: map[string]interface{}{"password": "czNjcjN0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// created by a concurrent replica between the listing and the create
+			client := fake.NewSimpleClientset(metaSecret("default", "app", map[string]string{"other": "x"}, nil))
+			client.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, apierrors.NewAlreadyExists(schema.GroupResource{Resource: "secrets"}, "app")
+			})
+			var patches []map[string]map[string]interface{}
+			client.PrependReactor("patch", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				var p map[string]map[string]interface{}
+				if err := json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &p); err != nil {
+					t.Fatal(err)
+				}
+				patches = append(patches, p)
+				return false, nil, nil
+			})
+			template := metaSecret("default", "app", map[string]string{"owner": "team-a", matchNameDirective: "app"}, map[string]string{"tier": "web"})
+			template.Data = map[string][]byte{"password": []byte("s3cr3t")}
+			created, err := CreateSecret(context.Background(), client, template, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created {
+				t.Error("created = true, want false")
+			}
+			if len(patches) != 1 {
+				t.Fatalf("got %d patches, want 1", len(patches))
+			}
+			p := patches[0]
+			if want := map[string]interface{}{"owner": "team-a"}; !reflect.DeepEqual(p["metadata"]["annotations"], want) {
+				t.Errorf("patched annotations = %v, want %v", p["metadata"]["annotations"], want)
+			}
+			if want := map[string]interface{}{"tier": "web"}; !reflect.DeepEqual(p["metadata"]["labels"], want) {
+				t.Errorf("patched labels = %v, want %v", p["metadata"]["labels"], want)
+			}
+			if !reflect.DeepEqual(p["data"], tt.wantData) {
+				t.Errorf("patched data = %v, want %v", p["data"], tt.wantData)
+			}
+			got, err := client.CoreV1().Secrets("default").Get(context.Background(), "app", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[string]string{"owner": "team-a", "other": "x"}; !reflect.DeepEqual(got.Annotations, want) {
+				t.Errorf("annotations = %v, want %v", got.Annotations, want)
+			}
+		})
+	}
+}
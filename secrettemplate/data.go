@@ -0,0 +1,79 @@
+package secrettemplate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// validateSecretData checks that every value under a Secret document's data field is a
+// valid base64 string, naming the offending key so the error is actionable
+func validateSecretData(doc []byte) error {
+	var raw struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := yaml.Unmarshal(doc, &raw); err != nil {
+		// leave reporting malformed documents to the decoder
+		return nil
+	}
+	if raw.Kind != "Secret" {
+		return nil
+	}
+	for k, v := range raw.Data {
+		sv, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("secret %s/%s: data key %q must be a base64 string, got %T", raw.Metadata.Namespace, raw.Metadata.Name, k, v)
+		}
+		if _, err := base64.StdEncoding.DecodeString(sv); err != nil {
+			return fmt.Errorf("secret %s/%s: data key %q is not valid base64: %v", raw.Metadata.Namespace, raw.Metadata.Name, k, err)
+		}
+	}
+	return nil
+}
+
+// SecretData returns the secret's data with its stringData merged in, matching how the
+// API server applies stringData on write
+func SecretData(secret *corev1.Secret) map[string][]byte {
+	if len(secret.Data) == 0 && len(secret.StringData) == 0 {
+		return nil
+	}
+	data := make(map[string][]byte, len(secret.Data)+len(secret.StringData))
+	for k, v := range secret.Data {
+		data[k] = v
+	}
+	for k, v := range secret.StringData {
+		data[k] = []byte(v)
+	}
+	return data
+}
+
+// changedDataKeys returns the sorted keys in desired whose value differs from current
+func changedDataKeys(current map[string][]byte, desired map[string][]byte) []string {
+	var keys []string
+	for k, v := range desired {
+		if cv, ok := current[k]; !ok || !bytes.Equal(cv, v) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedDataKeys returns the keys of data in sorted order
+func sortedDataKeys(data map[string][]byte) []string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
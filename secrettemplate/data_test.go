@@ -0,0 +1,160 @@
+package secrettemplate
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestValidateSecretData(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{
+			name: "valid base64",
+			doc:  "kind: Secret\nmetadata:\n  name: app\n  namespace: default\ndata:\n  password: aHVudGVyMg==\n",
+		},
+		{
+			name:    "invalid base64 names the key",
+			doc:     "kind: Secret\nmetadata:\n  name: app\n  namespace: default\ndata:\n  password: not base64!\n",
+			wantErr: `secret default/app: data key "password" is not valid base64`,
+		},
+		{
+			name:    "non-string value names the key",
+			doc:     "kind: Secret\nmetadata:\n  name: app\n  namespace: default\ndata:\n  port: 5432\n",
+			wantErr: `secret default/app: data key "port" must be a base64 string`,
+		},
+		{
+			name: "stringData is not base64",
+			doc:  "kind: Secret\nmetadata:\n  name: app\n  namespace: default\nstringData:\n  password: not base64!\n",
+		},
+		{
+			name: "other kinds are ignored",
+			doc:  "kind: ConfigMap\nmetadata:\n  name: app\ndata:\n  key: not base64!\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSecretData([]byte(tt.doc))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSecretData(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret corev1.Secret
+		want   map[string][]byte
+	}{
+		{name: "empty", want: nil},
+		{
+			name:   "data only",
+			secret: corev1.Secret{Data: map[string][]byte{"a": []byte("1")}},
+			want:   map[string][]byte{"a": []byte("1")},
+		},
+		{
+			name:   "stringData only",
+			secret: corev1.Secret{StringData: map[string]string{"b": "2"}},
+			want:   map[string][]byte{"b": []byte("2")},
+		},
+		{
+			name: "stringData takes precedence",
+			secret: corev1.Secret{
+				Data:       map[string][]byte{"a": []byte("1"), "b": []byte("old")},
+				StringData: map[string]string{"b": "2"},
+			},
+			want: map[string][]byte{"a": []byte("1"), "b": []byte("2")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SecretData(&tt.secret); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SecretData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSecretsData(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string][]byte
+		wantErr string
+	}{
+		{
+			name:    "data is decoded",
+			content: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: app\n  namespace: default\ndata:\n  password: aHVudGVyMg==\n",
+			want:    map[string][]byte{"password": []byte("hunter2")},
+		},
+		{
+			name:    "stringData is merged",
+			content: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: app\n  namespace: default\nstringData:\n  password: hunter2\n",
+			want:    map[string][]byte{"password": []byte("hunter2")},
+		},
+		{
+			name:    "invalid data fails with the file and key",
+			content: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: app\n  namespace: default\ndata:\n  password: hunter2!\n",
+			wantErr: `secrets.yaml: secret default/app: data key "password" is not valid base64`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secrets, err := ParseSecrets("secrets.yaml", tt.content, ParseOptions{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(secrets) != 1 {
+				t.Fatalf("parsed %d secrets, want 1", len(secrets))
+			}
+			if got := SecretData(secrets[0]); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SecretData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchSecretMetadataStringData(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Data:       map[string][]byte{"user": []byte("admin"), "password": []byte("old")},
+	})
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		StringData: map[string]string{"password": "hunter2"},
+	}
+	change := &Change{Namespace: "default", Name: "app", Data: []string{"password"}}
+	if err := PatchSecretMetadata(context.Background(), client, secret, change, PatchOptions{IncludeData: true}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.CoreV1().Secrets("default").Get(context.Background(), "app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{"user": []byte("admin"), "password": []byte("hunter2")}
+	if !reflect.DeepEqual(got.Data, want) {
+		t.Errorf("data = %v, want %v", got.Data, want)
+	}
+}
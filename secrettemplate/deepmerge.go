@@ -0,0 +1,67 @@
+package secrettemplate
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// merge strategies for annotation values defined by both the template and the secret
+const (
+	// MergeReplace overwrites the existing value with the template value
+	MergeReplace = "replace"
+	// MergeDeep merges JSON object values key by key, overwriting any other value
+	MergeDeep = "deep"
+)
+
+// mergeJSONObjects merges src into dst recursively, src winning for keys which are not
+// objects in both
+func mergeJSONObjects(dst, src map[string]interface{}) {
+	for k, sv := range src {
+		so, sok := sv.(map[string]interface{})
+		do, dok := dst[k].(map[string]interface{})
+		if sok && dok {
+			mergeJSONObjects(do, so)
+			continue
+		}
+		dst[k] = sv
+	}
+}
+
+// deepMergeValue returns desired merged into existing when both are JSON objects, keeping
+// existing verbatim if the merge adds nothing, and desired otherwise
+func deepMergeValue(existing, desired string) string {
+	var eo, do map[string]interface{}
+	if json.Unmarshal([]byte(existing), &eo) != nil || eo == nil {
+		return desired
+	}
+	if json.Unmarshal([]byte(desired), &do) != nil || do == nil {
+		return desired
+	}
+	var orig map[string]interface{}
+	_ = json.Unmarshal([]byte(existing), &orig)
+	mergeJSONObjects(eo, do)
+	if reflect.DeepEqual(eo, orig) {
+		return existing
+	}
+	jd, err := json.Marshal(eo)
+	if err != nil {
+		return desired
+	}
+	return string(jd)
+}
+
+// deepMergeAnnotations returns the desired annotations with each JSON object value merged
+// into the existing value of the same key
+func deepMergeAnnotations(existing, desired map[string]string) map[string]string {
+	if desired == nil {
+		return nil
+	}
+	merged := make(map[string]string, len(desired))
+	for k, v := range desired {
+		if ev, ok := existing[k]; ok {
+			v = deepMergeValue(ev, v)
+		}
+		merged[k] = v
+	}
+	return merged
+}
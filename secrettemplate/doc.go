@@ -0,0 +1,15 @@
+// Package secrettemplate merges the metadata of Secret templates into the matching
+// existing secrets of a cluster. It is the core of the k8s-secret-template CLI and can be
+// embedded in other tools, such as an operator, with an injected kubernetes.Interface.
+//
+// A reconcile parses the templates, computes the changes against the existing secrets,
+// merges the templates into them and patches the result:
+//
+//	templates, err := secrettemplate.ParseFilesAsSecrets(secrettemplate.GetSecretFiles(dir), secrettemplate.ParseOptions{})
+//	// list the existing secrets of secrettemplate.SecretNamespaces(templates) with client
+//	merged, changes, err := secrettemplate.MergeSecrets(templates, existing, opts)
+//	summary, err := secrettemplate.UpdateK8sSecretsMetadata(ctx, client, merged, changes, secrettemplate.PatchOptions{})
+//
+// MergeSecrets needs no cluster, so the merge semantics of a set of templates can be
+// checked against fixture secrets, e.g. in table-driven tests.
+package secrettemplate
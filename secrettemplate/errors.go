@@ -0,0 +1,61 @@
+package secrettemplate
+
+import (
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// sentinel errors which secret API errors are classified as, for use with errors.Is
+var (
+	ErrSecretNotFound = errors.New("secret not found")
+	ErrAlreadyExists  = errors.New("secret already exists")
+	ErrConflict       = errors.New("conflict")
+	ErrForbidden      = errors.New("forbidden")
+	ErrInvalid        = errors.New("invalid")
+)
+
+// apiError is an API error classified as one of the sentinel errors. It matches the
+// sentinel with errors.Is and still unwraps to the underlying API status error.
+type apiError struct {
+	kind error
+	err  error
+}
+
+// Error returns the message of the underlying API error
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+// Is reports whether target is the sentinel the error is classified as
+func (e *apiError) Is(target error) bool {
+	return target == e.kind
+}
+
+// Unwrap returns the underlying API error
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+// ClassifyAPIError wraps err in the sentinel matching its API status reason, returning
+// it unchanged if none match
+func ClassifyAPIError(err error) error {
+	var kind error
+	switch {
+	case err == nil:
+		return nil
+	case apierrors.IsNotFound(err):
+		kind = ErrSecretNotFound
+	case apierrors.IsAlreadyExists(err):
+		kind = ErrAlreadyExists
+	case apierrors.IsConflict(err):
+		kind = ErrConflict
+	case apierrors.IsForbidden(err):
+		kind = ErrForbidden
+	case apierrors.IsInvalid(err):
+		kind = ErrInvalid
+	default:
+		return err
+	}
+	return &apiError{kind: kind, err: err}
+}
@@ -0,0 +1,77 @@
+package secrettemplate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPatchSecretMetadataNotFound(t *testing.T) {
+	gr := schema.GroupResource{Resource: "secrets"}
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "not found status is ignored", err: apierrors.NewNotFound(gr, "app")},
+		{name: "internal error mentioning not found fails", err: apierrors.NewInternalError(errors.New("webhook config not found")), wantErr: true},
+		{name: "plain error mentioning not found fails", err: errors.New("admission plugin not found"), wantErr: true},
+		{name: "forbidden fails", err: apierrors.NewForbidden(gr, "app", errors.New("denied")), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			client.PrependReactor("patch", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, tt.err
+			})
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", Annotations: map[string]string{"a": "1"}}}
+			change := &Change{Namespace: "default", Name: "app", Annotations: []string{"a"}}
+			err := PatchSecretMetadata(context.Background(), client, secret, change, PatchOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClassifyAPIError(t *testing.T) {
+	gr := schema.GroupResource{Resource: "secrets"}
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "not found", err: apierrors.NewNotFound(gr, "app"), want: ErrSecretNotFound},
+		{name: "already exists", err: apierrors.NewAlreadyExists(gr, "app"), want: ErrAlreadyExists},
+		{name: "conflict", err: apierrors.NewConflict(gr, "app", errors.New("modified")), want: ErrConflict},
+		{name: "forbidden", err: apierrors.NewForbidden(gr, "app", errors.New("denied")), want: ErrForbidden},
+		{name: "invalid", err: apierrors.NewInvalid(schema.GroupKind{Kind: "Secret"}, "app", nil), want: ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ClassifyAPIError(tt.err)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ClassifyAPIError(%v) is not %v", tt.err, tt.want)
+			}
+			var status apierrors.APIStatus
+			if !errors.As(err, &status) {
+				t.Errorf("ClassifyAPIError(%v) no longer unwraps to the status error", tt.err)
+			}
+		})
+	}
+	plain := errors.New("secret not found in cache")
+	if err := ClassifyAPIError(plain); err != plain || errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("ClassifyAPIError(%v) = %v, want it unchanged", plain, err)
+	}
+	if ClassifyAPIError(nil) != nil {
+		t.Error("ClassifyAPIError(nil) is not nil")
+	}
+}
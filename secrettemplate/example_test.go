@@ -0,0 +1,102 @@
+package secrettemplate_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const exampleTemplates = `apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+  namespace: default
+  annotations:
+    example.com/owner: team-a
+  labels:
+    tier: web
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+  namespace: default
+  annotations:
+    example.com/owner: team-b
+`
+
+func ExampleParseSecrets() {
+	templates, err := secrettemplate.ParseSecrets("secrets.yaml", exampleTemplates, secrettemplate.ParseOptions{})
+	if err != nil {
+		panic(err)
+	}
+	for _, t := range templates {
+		fmt.Println(t.Namespace+"/"+t.Name, t.Annotations)
+	}
+	fmt.Println(secrettemplate.SecretNamespaces(templates))
+	// Output:
+	// default/app map[example.com/owner:team-a]
+	// default/db map[example.com/owner:team-b]
+	// [default]
+}
+
+func ExampleMergeSecrets() {
+	templates, err := secrettemplate.ParseSecrets("secrets.yaml", exampleTemplates, secrettemplate.ParseOptions{})
+	if err != nil {
+		panic(err)
+	}
+	existing := []corev1.Secret{{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "app",
+		Annotations: map[string]string{"example.com/owner": "team-a", "example.com/rotated": "2021-06-01"},
+	}}}
+	merged, changes, err := secrettemplate.MergeSecrets(templates, existing, secrettemplate.MergeOptions{})
+	if err != nil {
+		panic(err)
+	}
+	for _, s := range merged {
+		fmt.Println(s.Name, s.Annotations, s.Labels)
+	}
+	// db matches no existing secret, so it has no change and is not created or patched
+	for _, c := range changes {
+		fmt.Println(c.Name, "annotations:", c.Annotations, "labels:", c.Labels)
+	}
+	// Output:
+	// app map[example.com/owner:team-a example.com/rotated:2021-06-01] map[tier:web]
+	// db map[example.com/owner:team-b] map[]
+	// app annotations: [] labels: [tier]
+}
+
+func ExampleUpdateK8sSecretsMetadata() {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}})
+	templates, err := secrettemplate.ParseSecrets("secrets.yaml", exampleTemplates, secrettemplate.ParseOptions{})
+	if err != nil {
+		panic(err)
+	}
+	list, err := client.CoreV1().Secrets("default").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		panic(err)
+	}
+	merged, changes, err := secrettemplate.MergeSecrets(templates, list.Items, secrettemplate.MergeOptions{})
+	if err != nil {
+		panic(err)
+	}
+	summary, err := secrettemplate.UpdateK8sSecretsMetadata(ctx, client, merged, changes, secrettemplate.PatchOptions{})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("patched:", summary.Patched)
+	s, err := client.CoreV1().Secrets("default").Get(ctx, "app", metav1.GetOptions{})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(s.Annotations, s.Labels)
+	// Output:
+	// patched: 1
+	// map[example.com/owner:team-a] map[tier:web]
+}
@@ -0,0 +1,89 @@
+package secrettemplate
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// matchExpressionDirective is a template annotation holding a CEL predicate, evaluated
+// against each existing secret in its namespace, which applies the template to the
+// secrets for which it is true
+const matchExpressionDirective = "k8s-secret-template/match-expression"
+
+// exprPrograms caches the compiled programs by expression, as matchers are created per
+// template for every match
+var exprPrograms sync.Map
+
+// compileExpression returns the program of a CEL predicate over the secret variable,
+// compiling it on first use
+func compileExpression(expr string) (cel.Program, error) {
+	if p, ok := exprPrograms.Load(expr); ok {
+		return p.(cel.Program), nil
+	}
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar("secret", decls.NewMapType(decls.String, decls.Dyn)),
+	))
+	if err != nil {
+		return nil, err
+	}
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	exprPrograms.Store(expr, prg)
+	return prg, nil
+}
+
+// secretVariable returns the value of the secret variable of match expressions: the
+// secret's metadata and type, without its data
+func secretVariable(secret *corev1.Secret) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":        secret.Name,
+			"namespace":   secret.Namespace,
+			"labels":      stringMap(secret.Labels),
+			"annotations": stringMap(secret.Annotations),
+		},
+		"type": string(secret.Type),
+	}
+}
+
+// stringMap returns m, or an empty map when m is nil, so expressions can index it
+func stringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+// exprMatcher matches secrets for which a CEL predicate is true
+type exprMatcher struct {
+	expr string
+	prg  cel.Program
+}
+
+// Matches returns true if the predicate evaluates to true for the secret. Evaluation
+// errors and non-boolean results are logged and do not match.
+func (m exprMatcher) Matches(secret *corev1.Secret) bool {
+	out, _, err := m.prg.Eval(map[string]interface{}{"secret": secretVariable(secret)})
+	if err == nil {
+		if b, ok := out.Value().(bool); ok {
+			return b
+		}
+		err = fmt.Errorf("result %v is not a bool", out.Value())
+	}
+	log.WithFields(log.Fields{
+		"action": "matchExpression",
+		"secret": secret.Namespace + "/" + secret.Name,
+	}).Warnf("%s %q: %v", matchExpressionDirective, m.expr, err)
+	return false
+}
@@ -0,0 +1,124 @@
+package secrettemplate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// namespacesDirective is a template annotation listing, separated by commas or
+// whitespace, the namespaces the template is expanded into
+const namespacesDirective = "k8s-secret-template/namespaces"
+
+// environ returns the process environment as a map
+func environ() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	return env
+}
+
+// templateNamespaceList returns the namespaces of the template's namespaces directive,
+// rendering it as a text/template with .Env and .Values first if templating is set
+func templateNamespaceList(t *corev1.Secret, templating bool, values map[string]interface{}) ([]string, error) {
+	v := t.Annotations[namespacesDirective]
+	if templating && strings.Contains(v, "{{") {
+		tp, err := template.New(namespacesDirective).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		data := struct {
+			Env    map[string]string
+			Values map[string]interface{}
+		}{environ(), values}
+		if err := tp.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		v = b.String()
+	}
+	return strings.FieldsFunc(v, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	}), nil
+}
+
+// ExpandNamespaces replaces each template carrying the namespaces directive with a copy
+// per listed namespace. A template may not set both metadata.namespace and the directive.
+func ExpandNamespaces(templates []*corev1.Secret, templating bool, values map[string]interface{}) ([]*corev1.Secret, error) {
+	l := log.WithFields(log.Fields{
+		"action": "ExpandNamespaces",
+	})
+	var expanded []*corev1.Secret
+	for _, t := range templates {
+		if _, ok := t.Annotations[namespacesDirective]; !ok {
+			expanded = append(expanded, t)
+			continue
+		}
+		if t.Namespace != "" {
+			return nil, fmt.Errorf("secret %s/%s: %s cannot be combined with metadata.namespace", t.Namespace, t.Name, namespacesDirective)
+		}
+		namespaces, err := templateNamespaceList(t, templating, values)
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %s: %w", t.Name, namespacesDirective, err)
+		}
+		l.Printf("secret %s expanded into namespaces: %s", t.Name, strings.Join(namespaces, ","))
+		for _, ns := range namespaces {
+			et := t.DeepCopy()
+			et.Namespace = ns
+			expanded = append(expanded, et)
+		}
+	}
+	return expanded, nil
+}
+
+// ReplicateNamespaces returns the templates followed, for each, by a copy per namespace
+// of namespaces other than its own, so its metadata also applies to the secrets it
+// matches in those namespaces
+func ReplicateNamespaces(templates []*corev1.Secret, namespaces []string) []*corev1.Secret {
+	l := log.WithFields(log.Fields{
+		"action": "ReplicateNamespaces",
+	})
+	if len(namespaces) == 0 {
+		return templates
+	}
+	var replicated []*corev1.Secret
+	for _, t := range templates {
+		replicated = append(replicated, t)
+		seen := map[string]bool{t.Namespace: true}
+		for _, ns := range namespaces {
+			if seen[ns] {
+				continue
+			}
+			seen[ns] = true
+			rt := t.DeepCopy()
+			rt.Namespace = ns
+			replicated = append(replicated, rt)
+		}
+		l.Printf("secret %s/%s replicated into namespaces: %d", t.Namespace, t.Name, len(seen)-1)
+	}
+	return replicated
+}
+
+// RemapNamespaces moves each template whose namespace is a key of namespaces into the
+// namespace it maps to. Templates of other namespaces, or without one, are left as is.
+func RemapNamespaces(templates []*corev1.Secret, namespaces map[string]string) {
+	l := log.WithFields(log.Fields{
+		"action": "RemapNamespaces",
+	})
+	for _, t := range templates {
+		ns, ok := namespaces[t.Namespace]
+		if !ok || t.Namespace == "" {
+			continue
+		}
+		l.Printf("secret %s/%s remapped to namespace %s", t.Namespace, t.Name, ns)
+		t.Namespace = ns
+	}
+}
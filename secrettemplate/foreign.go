@@ -0,0 +1,174 @@
+package secrettemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FieldManager is the field manager name the tool patches secrets as
+const FieldManager = "k8s-secret-template"
+
+// foreignOwners returns the controllers other than the field manager that appear to manage
+// the secret, based on its owner references and managedFields entries
+func foreignOwners(secret corev1.Secret, manager string) []string {
+	var owners []string
+	for _, o := range secret.OwnerReferences {
+		owners = append(owners, o.Kind+"/"+o.Name)
+	}
+	for _, mf := range secret.ManagedFields {
+		if mf.Manager == manager || mf.Manager == FieldManager || strings.HasPrefix(mf.Manager, "kubectl") {
+			continue
+		}
+		owners = append(owners, mf.Manager)
+	}
+	return owners
+}
+
+// IsManaged reports whether the tool manages the secret: a managedFields entry of manager,
+// FieldManager when empty, or an annotation or label key under the non-empty prefix
+func IsManaged(secret corev1.Secret, manager string, prefix string) bool {
+	if manager == "" {
+		manager = FieldManager
+	}
+	for _, mf := range secret.ManagedFields {
+		if mf.Manager == manager {
+			return true
+		}
+	}
+	if prefix == "" {
+		return false
+	}
+	for _, m := range []map[string]string{secret.Annotations, secret.Labels} {
+		for k := range m {
+			if strings.HasPrefix(k, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FilterForeignChanges warns about changes to secrets managed by controllers other than
+// the field manager, dropping them from the changes if respect is set. An empty manager
+// is FieldManager.
+func FilterForeignChanges(changes []Change, existingSecrets []corev1.Secret, manager string, respect bool) []Change {
+	l := log.WithFields(
+		log.Fields{
+			"action": "filterForeignChanges",
+		})
+	var filtered []Change
+changesLoop:
+	for _, c := range changes {
+		for _, rs := range existingSecrets {
+			if rs.Namespace != c.Namespace || rs.Name != c.Name {
+				continue
+			}
+			owners := foreignOwners(rs, manager)
+			if len(owners) == 0 {
+				break
+			}
+			if respect {
+				l.Warnf("skip secret %s/%s managed by: %s", c.Namespace, c.Name, strings.Join(owners, ","))
+				continue changesLoop
+			}
+			l.Warnf("secret %s/%s is also managed by: %s", c.Namespace, c.Name, strings.Join(owners, ","))
+			break
+		}
+		filtered = append(filtered, c)
+	}
+	return filtered
+}
+
+// appliedKeys returns the keys under path of the fields set of a server-side apply
+// managedFields entry
+func appliedKeys(mf metav1.ManagedFieldsEntry, path ...string) map[string]bool {
+	if mf.FieldsV1 == nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(mf.FieldsV1.Raw, &fields); err != nil {
+		return nil
+	}
+	for _, p := range path {
+		next, ok := fields["f:"+p].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields = next
+	}
+	keys := make(map[string]bool, len(fields))
+	for k := range fields {
+		if strings.HasPrefix(k, "f:") {
+			keys[strings.TrimPrefix(k, "f:")] = true
+		}
+	}
+	return keys
+}
+
+// ownershipConflicts returns the keys of the change which a field manager other than
+// manager owns through server-side apply, and which it would set back on its next apply
+func ownershipConflicts(secret corev1.Secret, c Change, manager string) []string {
+	var conflicts []string
+	for _, mf := range secret.ManagedFields {
+		if mf.Manager == manager || mf.Operation != metav1.ManagedFieldsOperationApply {
+			continue
+		}
+		for _, f := range []struct {
+			kind string
+			path []string
+			keys [][]string
+		}{
+			{"annotation", []string{"metadata", "annotations"}, [][]string{c.Annotations, c.RemoveAnnotations}},
+			{"label", []string{"metadata", "labels"}, [][]string{c.Labels, c.RemoveLabels}},
+			{"data", []string{"data"}, [][]string{c.Data}},
+		} {
+			owned := appliedKeys(mf, f.path...)
+			for _, ks := range f.keys {
+				for _, k := range ks {
+					if owned[k] {
+						conflicts = append(conflicts, fmt.Sprintf("%s %s (applied by %s)", f.kind, k, mf.Manager))
+					}
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// CheckFieldOwnership warns about changed keys which a field manager other than manager
+// owns through server-side apply, as the two would keep overwriting each other. With
+// strict set, any such key is an error instead. An empty manager is FieldManager.
+func CheckFieldOwnership(changes []Change, existingSecrets []corev1.Secret, manager string, strict bool) error {
+	if manager == "" {
+		manager = FieldManager
+	}
+	l := log.WithFields(
+		log.Fields{
+			"action": "checkFieldOwnership",
+		})
+	var conflicted []string
+	for _, c := range changes {
+		for _, rs := range existingSecrets {
+			if rs.Namespace != c.Namespace || rs.Name != c.Name {
+				continue
+			}
+			conflicts := ownershipConflicts(rs, c, manager)
+			if len(conflicts) == 0 {
+				break
+			}
+			msg := fmt.Sprintf("secret %s/%s: %s", c.Namespace, c.Name, strings.Join(conflicts, ", "))
+			l.Warnf("changing keys owned by another field manager: %s", msg)
+			conflicted = append(conflicted, msg)
+			break
+		}
+	}
+	if strict && len(conflicted) > 0 {
+		return fmt.Errorf("%d secrets change keys owned by another field manager: %s", len(conflicted), strings.Join(conflicted, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package secrettemplate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// includeDirective is the line prefix which inlines another file into a template
+const includeDirective = "!include "
+
+// resolveIncludes replaces every "!include path" line in content with the content of
+// the referenced file, resolved relative to file. stack holds the files currently being
+// included and is used to detect cycles.
+func resolveIncludes(file string, content string, stack []string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range stack {
+		if f == abs {
+			return "", fmt.Errorf("include cycle detected: %s -> %s", strings.Join(stack, " -> "), abs)
+		}
+	}
+	stack = append(stack, abs)
+	lines := strings.Split(content, "\n")
+	var result []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, includeDirective) {
+			result = append(result, line)
+			continue
+		}
+		ip := strings.TrimSpace(strings.TrimPrefix(trimmed, includeDirective))
+		if !filepath.IsAbs(ip) {
+			ip = filepath.Join(filepath.Dir(abs), ip)
+		}
+		id, err := os.ReadFile(ip)
+		if err != nil {
+			return "", fmt.Errorf("%s: include %s: %w", file, ip, err)
+		}
+		ic, err := resolveIncludes(ip, string(id), stack)
+		if err != nil {
+			return "", err
+		}
+		result = append(result, ic)
+	}
+	return strings.Join(result, "\n"), nil
+}
@@ -0,0 +1,70 @@
+package secrettemplate
+
+import (
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Document is a raw manifest document read from a Source
+type Document struct {
+	// Name identifies the document in logs and errors. For files it is the path, which
+	// @file annotation sources are resolved against.
+	Name    string
+	Content string
+}
+
+// Source yields the raw manifest documents of a template input, such as a directory of
+// files or a rendered kustomization
+type Source interface {
+	Documents() ([]Document, error)
+}
+
+// FileSource reads the template files, resolving their !include directives if
+// ResolveIncludes is set
+type FileSource struct {
+	Files           []string
+	ResolveIncludes bool
+}
+
+// Documents returns the content of each file
+func (s *FileSource) Documents() ([]Document, error) {
+	docs := make([]Document, 0, len(s.Files))
+	for _, file := range s.Files {
+		fd, err := os.ReadFile(file)
+		if err != nil {
+			log.Errorf("Failed to read file: %s", err)
+			return nil, err
+		}
+		content := string(fd)
+		if s.ResolveIncludes {
+			content, err = resolveIncludes(file, content, nil)
+			if err != nil {
+				log.Errorf("Failed to resolve includes: %s", err)
+				return nil, err
+			}
+		}
+		docs = append(docs, Document{Name: file, Content: content})
+	}
+	return docs, nil
+}
+
+// ParseSource decodes the Secret documents of the source, skipping documents of any
+// other kind
+func ParseSource(src Source, opts ParseOptions) ([]*corev1.Secret, error) {
+	docs, err := src.Documents()
+	if err != nil {
+		return nil, err
+	}
+	var secrets []*corev1.Secret
+	for _, d := range docs {
+		log.WithField("action", "parseSource").Printf("document: %s", d.Name)
+		ds, err := ParseSecrets(d.Name, d.Content, opts)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, ds...)
+	}
+	return secrets, nil
+}
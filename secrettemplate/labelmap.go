@@ -0,0 +1,36 @@
+package secrettemplate
+
+// LabelMapping derives an annotation from a label of the matched secret: the value of
+// SourceLabel is looked up in Values and the result set as TargetAnnotation. Label values
+// missing from Values map to Default, and without a Default set no annotation.
+type LabelMapping struct {
+	SourceLabel      string            `json:"sourceLabel"`
+	TargetAnnotation string            `json:"targetAnnotation"`
+	Values           map[string]string `json:"values"`
+	Default          string            `json:"default,omitempty"`
+}
+
+// mappedAnnotations returns the annotations the mappings derive from the labels. Secrets
+// without a mapping's source label get nothing from it, and of several mappings setting
+// the same annotation the last one applying wins.
+func mappedAnnotations(mappings []LabelMapping, labels map[string]string) map[string]string {
+	var a map[string]string
+	for _, m := range mappings {
+		lv, ok := labels[m.SourceLabel]
+		if !ok {
+			continue
+		}
+		v, ok := m.Values[lv]
+		if !ok {
+			if m.Default == "" {
+				continue
+			}
+			v = m.Default
+		}
+		if a == nil {
+			a = make(map[string]string, len(mappings))
+		}
+		a[m.TargetAnnotation] = v
+	}
+	return a
+}
@@ -0,0 +1,61 @@
+package secrettemplate
+
+import "strings"
+
+// splitList returns the non-empty items of a separated list value, trimmed of whitespace.
+// A whitespace separator splits on any run of whitespace.
+func splitList(v string, sep string) []string {
+	var items []string
+	if strings.TrimSpace(sep) == "" {
+		return strings.Fields(v)
+	}
+	for _, item := range strings.Split(v, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// unionList returns the items of existing followed by those of desired it lacks, without
+// duplicates, joined with sep. Existing is returned verbatim if desired adds nothing.
+func unionList(existing, desired string, sep string) string {
+	seen := map[string]bool{}
+	var items []string
+	for _, item := range splitList(existing, sep) {
+		if !seen[item] {
+			seen[item] = true
+			items = append(items, item)
+		}
+	}
+	added := false
+	for _, item := range splitList(desired, sep) {
+		if !seen[item] {
+			seen[item] = true
+			items = append(items, item)
+			added = true
+		}
+	}
+	if !added {
+		return existing
+	}
+	return strings.Join(items, sep)
+}
+
+// listMergeAnnotations returns desired with the value of each key of lists, mapping list
+// annotation keys to their separator, unioned with the existing value of that key
+func listMergeAnnotations(existing, desired map[string]string, lists map[string]string) map[string]string {
+	if len(lists) == 0 || len(desired) == 0 {
+		return desired
+	}
+	merged := make(map[string]string, len(desired))
+	for k, v := range desired {
+		if sep, ok := lists[k]; ok {
+			if ev, ok := existing[k]; ok {
+				v = unionList(ev, v, sep)
+			}
+		}
+		merged[k] = v
+	}
+	return merged
+}
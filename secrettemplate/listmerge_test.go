@@ -0,0 +1,49 @@
+package secrettemplate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnionList(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		desired  string
+		sep      string
+		want     string
+	}{
+		{name: "adds missing items", existing: "us,ap", desired: "eu,us", sep: ",", want: "us,ap,eu"},
+		{name: "nothing to add keeps existing verbatim", existing: "us, ap", desired: "ap", sep: ",", want: "us, ap"},
+		{name: "dedupes existing when adding", existing: "us,us,ap", desired: "eu", sep: ",", want: "us,ap,eu"},
+		{name: "dedupes desired", existing: "us", desired: "eu,eu", sep: ",", want: "us,eu"},
+		{name: "trims items", existing: " us , ap ", desired: " eu ", sep: ",", want: "us,ap,eu"},
+		{name: "skips empty items", existing: "us,,ap,", desired: ",eu", sep: ",", want: "us,ap,eu"},
+		{name: "empty existing", existing: "", desired: "eu,us", sep: ",", want: "eu,us"},
+		{name: "multi character separator", existing: "a; b", desired: "c", sep: "; ", want: "a; b; c"},
+		{name: "whitespace separator splits on runs", existing: "a  b\tc", desired: "d a", sep: " ", want: "a b c d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unionList(tt.existing, tt.desired, tt.sep); got != tt.want {
+				t.Errorf("unionList() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListMergeAnnotations(t *testing.T) {
+	existing := map[string]string{"sync-to": "us,ap", "teams": "a b", "owner": "team-a"}
+	desired := map[string]string{"sync-to": "eu,us", "teams": "c", "owner": "team-b", "new": "x,y"}
+	lists := map[string]string{"sync-to": ",", "teams": " ", "new": ","}
+	want := map[string]string{"sync-to": "us,ap,eu", "teams": "a b c", "owner": "team-b", "new": "x,y"}
+	if got := listMergeAnnotations(existing, desired, lists); !reflect.DeepEqual(got, want) {
+		t.Errorf("listMergeAnnotations() = %v, want %v", got, want)
+	}
+	if got := listMergeAnnotations(existing, desired, nil); !reflect.DeepEqual(got, desired) {
+		t.Errorf("listMergeAnnotations() without lists = %v, want %v", got, desired)
+	}
+	if desired["sync-to"] != "eu,us" {
+		t.Errorf("desired was modified: %v", desired)
+	}
+}
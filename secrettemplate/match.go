@@ -0,0 +1,236 @@
+package secrettemplate
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// matchNameDirective is a template annotation holding a glob which applies the template
+	// to every existing secret in its namespace with a matching name
+	matchNameDirective = "k8s-secret-template/match-name"
+	// matchLabelsDirective is a template annotation holding a label selector which applies
+	// the template to every existing secret in its namespace matching the selector
+	matchLabelsDirective = "k8s-secret-template/match-labels"
+	// matchAnnotationDirective is a template annotation of the form key=value, or key to
+	// match on presence alone, which applies the template to every existing secret in its
+	// namespace carrying that annotation
+	matchAnnotationDirective = "k8s-secret-template/match-annotation"
+	// matchOwnerDirective is a template annotation of the form Kind/name, or Kind to match
+	// any owner of that kind, which applies the template to every existing secret in its
+	// namespace with a matching owner reference
+	matchOwnerDirective = "k8s-secret-template/match-owner"
+)
+
+// templateDirectives are template annotations which configure matching and versioning
+// and are never applied to existing secrets
+var templateDirectives = map[string]bool{
+	matchNameDirective:       true,
+	matchLabelsDirective:     true,
+	matchAnnotationDirective: true,
+	matchOwnerDirective:      true,
+	matchExpressionDirective: true,
+	templateVersionDirective: true,
+	namespacesDirective:      true,
+	copyDataDirective:        true,
+}
+
+// Matcher selects the existing secrets, within a template's namespace, that the template
+// applies to
+type Matcher interface {
+	Matches(secret *corev1.Secret) bool
+}
+
+// nameMatcher matches the secret with the template's name. It is the default matcher.
+type nameMatcher struct {
+	name string
+}
+
+// Matches returns true if the secret has the template's name
+func (m nameMatcher) Matches(secret *corev1.Secret) bool {
+	return secret.Name == m.name
+}
+
+// globMatcher matches secrets whose name matches a path.Match glob
+type globMatcher struct {
+	pattern string
+}
+
+// Matches returns true if the secret's name matches the glob
+func (m globMatcher) Matches(secret *corev1.Secret) bool {
+	ok, _ := path.Match(m.pattern, secret.Name)
+	return ok
+}
+
+// labelSelectorMatcher matches secrets whose labels satisfy a label selector
+type labelSelectorMatcher struct {
+	selector labels.Selector
+}
+
+// Matches returns true if the secret's labels satisfy the selector
+func (m labelSelectorMatcher) Matches(secret *corev1.Secret) bool {
+	return m.selector.Matches(labels.Set(secret.Labels))
+}
+
+// annotationMatcher matches secrets carrying an annotation, optionally with a given value
+type annotationMatcher struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// Matches returns true if the secret has the annotation, with the value if one is set
+func (m annotationMatcher) Matches(secret *corev1.Secret) bool {
+	v, ok := secret.Annotations[m.key]
+	return ok && (!m.hasValue || v == m.value)
+}
+
+// ownerMatcher matches secrets with an owner reference of a kind, optionally with a name
+type ownerMatcher struct {
+	kind string
+	name string
+}
+
+// Matches returns true if one of the secret's owner references has the kind, and the
+// name if one is set
+func (m ownerMatcher) Matches(secret *corev1.Secret) bool {
+	for _, o := range secret.OwnerReferences {
+		if o.Kind == m.kind && (m.name == "" || o.Name == m.name) {
+			return true
+		}
+	}
+	return false
+}
+
+// allMatcher matches secrets matched by every one of its matchers
+type allMatcher []Matcher
+
+// Matches returns true if every matcher matches the secret
+func (m allMatcher) Matches(secret *corev1.Secret) bool {
+	for _, mm := range m {
+		if !mm.Matches(secret) {
+			return false
+		}
+	}
+	return true
+}
+
+// TemplateAnnotations returns the template's annotations without its directives
+func TemplateAnnotations(t *corev1.Secret) map[string]string {
+	var a map[string]string
+	for k, v := range t.Annotations {
+		if templateDirectives[k] {
+			continue
+		}
+		if a == nil {
+			a = make(map[string]string, len(t.Annotations))
+		}
+		a[k] = v
+	}
+	return a
+}
+
+// parseAnnotationMatch parses a key=value, or bare key, annotation match expression
+func parseAnnotationMatch(expr string) (annotationMatcher, error) {
+	m := annotationMatcher{key: strings.TrimSpace(expr)}
+	if i := strings.Index(expr, "="); i >= 0 {
+		m.key, m.value, m.hasValue = strings.TrimSpace(expr[:i]), strings.TrimSpace(expr[i+1:]), true
+	}
+	if m.key == "" {
+		return m, fmt.Errorf("invalid annotation match %q, expected key=value or key", expr)
+	}
+	return m, nil
+}
+
+// parseOwnerMatch parses a Kind/name, or bare Kind, owner match expression
+func parseOwnerMatch(expr string) (ownerMatcher, error) {
+	kind, name := strings.TrimSpace(expr), ""
+	if i := strings.Index(expr, "/"); i >= 0 {
+		kind, name = strings.TrimSpace(expr[:i]), strings.TrimSpace(expr[i+1:])
+	}
+	if kind == "" || strings.Contains(name, "/") {
+		return ownerMatcher{}, fmt.Errorf("invalid owner match %q, expected Kind/name or Kind", expr)
+	}
+	return ownerMatcher{kind: kind, name: name}, nil
+}
+
+// newMatcher returns the matcher configured by the template's directives. When several
+// directives are set a secret must satisfy all of them, and when none are set the
+// template matches the secret of the same name.
+func newMatcher(t *corev1.Secret) (Matcher, error) {
+	var ms allMatcher
+	if p, ok := t.Annotations[matchNameDirective]; ok {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", matchNameDirective, p, err)
+		}
+		ms = append(ms, globMatcher{pattern: p})
+	}
+	if s, ok := t.Annotations[matchLabelsDirective]; ok {
+		sel, err := labels.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", matchLabelsDirective, s, err)
+		}
+		ms = append(ms, labelSelectorMatcher{selector: sel})
+	}
+	if expr, ok := t.Annotations[matchAnnotationDirective]; ok {
+		am, err := parseAnnotationMatch(expr)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, am)
+	}
+	if expr, ok := t.Annotations[matchOwnerDirective]; ok {
+		om, err := parseOwnerMatch(expr)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, om)
+	}
+	if expr, ok := t.Annotations[matchExpressionDirective]; ok {
+		prg, err := compileExpression(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", matchExpressionDirective, expr, err)
+		}
+		ms = append(ms, exprMatcher{expr: expr, prg: prg})
+	}
+	switch len(ms) {
+	case 0:
+		return nameMatcher{name: t.Name}, nil
+	case 1:
+		return ms[0], nil
+	}
+	return ms, nil
+}
+
+// validateDirectives checks that the template's directives are well formed
+func validateDirectives(t *corev1.Secret) error {
+	if _, err := newMatcher(t); err != nil {
+		return fmt.Errorf("secret %s/%s: %w", t.Namespace, t.Name, err)
+	}
+	if v, ok := t.Annotations[copyDataDirective]; ok {
+		if _, err := parseDataSource(v); err != nil {
+			return fmt.Errorf("secret %s/%s: %w", t.Namespace, t.Name, err)
+		}
+	}
+	return nil
+}
+
+// MatchingSecrets returns the existing secrets in the template's namespace that its
+// matcher selects
+func MatchingSecrets(t *corev1.Secret, existingSecrets []corev1.Secret) []corev1.Secret {
+	m, err := newMatcher(t)
+	if err != nil {
+		return nil
+	}
+	var matches []corev1.Secret
+	for i, rs := range existingSecrets {
+		if rs.Namespace == t.Namespace && m.Matches(&existingSecrets[i]) {
+			matches = append(matches, rs)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,157 @@
+package secrettemplate
+
+import (
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func mergeAnnotations(annotations map[string]string, annotationsToMerge map[string]string) map[string]string {
+	if annotations == nil {
+		annotations = make(map[string]string, len(annotationsToMerge))
+	}
+	for k, v := range annotationsToMerge {
+		annotations[k] = v
+	}
+	return annotations
+}
+
+func mergeLabels(labels map[string]string, labelsToMerge map[string]string) map[string]string {
+	if labels == nil {
+		labels = make(map[string]string, len(labelsToMerge))
+	}
+	for k, v := range labelsToMerge {
+		labels[k] = v
+	}
+	return labels
+}
+
+// mergedAnnotations returns a copy of current with desired merged in and the remove keys
+// deleted, the annotations the secret has once patched
+func mergedAnnotations(current map[string]string, desired map[string]string, remove []string) map[string]string {
+	a := mergeAnnotations(mergeAnnotations(nil, current), desired)
+	for _, k := range remove {
+		delete(a, k)
+	}
+	return a
+}
+
+// SortedKeys returns the keys of m in sorted order
+func SortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatMetadata renders m as a stable, key-sorted k=v list for logging
+func formatMetadata(m map[string]string) string {
+	var pairs []string
+	for _, k := range SortedKeys(m) {
+		pairs = append(pairs, k+"="+m[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// UpdateSecretMetadata returns, for each template, a copy per matching existing secret with
+// the template metadata merged into the existing metadata, so a glob or selector template
+// updates every secret it matches and a name template the one secret of its name.
+// Templates matching no existing secret are returned with their metadata validated, and
+// rendered if opts.Templating is set. Merged secrets whose annotations exceed the total
+// size limit are logged, and left out with opts.StrictMetadata.
+func UpdateSecretMetadata(newSecrets []*corev1.Secret, existingSecrets []corev1.Secret, opts MergeOptions) ([]*corev1.Secret, error) {
+	l := log.WithFields(
+		log.Fields{
+			"action": "updateSecretMetadata",
+			"new":    len(newSecrets),
+			"old":    len(existingSecrets),
+		})
+	l.Print("updateSecretMetadata")
+	var updated []*corev1.Secret
+	for _, ls := range newSecrets {
+		l.Printf("new secret: %s/%s", ls.Namespace, ls.Name)
+		matches := MatchingSecrets(ls, existingSecrets)
+		if len(matches) == 0 {
+			var ta, tl map[string]string
+			var err error
+			if opts.Templating {
+				ta, tl, err = desiredMetadata(ls, ls, opts)
+			} else {
+				// directives stay on unmatched templates, they are valid keys
+				ta, tl, err = validateMetadata(ls, ls.Annotations, ls.Labels, opts.StrictMetadata)
+				if err == nil && opts.Checksum {
+					// the checksum is that of the desired metadata the next run compares
+					var da map[string]string
+					if da, _, err = desiredMetadata(ls, ls, opts); err == nil {
+						ta = mergeAnnotations(mergeAnnotations(nil, ta), map[string]string{ChecksumAnnotation: da[ChecksumAnnotation]})
+					}
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+			us := ls.DeepCopy()
+			us.Annotations = ta
+			us.Labels = tl
+			updated = append(updated, us)
+			continue
+		}
+		matches, skipped := skipProcessed(skipPinned(ls, matches), opts.OnlyIfMissing)
+		if skipped > 0 {
+			l.Printf("skip already processed secrets with annotation %s: %d", opts.OnlyIfMissing, skipped)
+		}
+		for _, rs := range matches {
+			l.Printf("update secret: %s/%s", rs.Namespace, rs.Name)
+			ta, tl, err := desiredMetadata(ls, &rs, opts)
+			if err != nil {
+				return nil, err
+			}
+			var ra, rl []string
+			if opts.Replace {
+				ra = removedKeys(rs.Annotations, ta, opts.ManagementPrefix, opts.NeverRemove)
+				rl = removedKeys(rs.Labels, tl, opts.ManagementPrefix, opts.NeverRemove)
+			}
+			// merge into copies, leaving the existing secrets as listed
+			a := mergedAnnotations(rs.Annotations, ta, ra)
+			if !checkMergedSize(&rs, a, opts.StrictMetadata) {
+				continue
+			}
+			lb := mergeLabels(mergeLabels(nil, rs.Labels), tl)
+			for _, k := range rl {
+				delete(lb, k)
+			}
+			us := ls.DeepCopy()
+			us.Name = rs.Name
+			us.Namespace = rs.Namespace
+			// patches are preconditioned on the listed secret, so that keys another writer
+			// changed since are not overwritten with their listed values
+			us.ResourceVersion = rs.ResourceVersion
+			us.Annotations = a
+			us.Labels = lb
+			l.Printf("merged annotations: %s", formatMetadata(a))
+			l.Printf("merged labels: %s", formatMetadata(lb))
+			updated = append(updated, us)
+		}
+	}
+	return updated, nil
+}
+
+// MergeSecrets computes, without a cluster, the result of applying the templates to the
+// existing secrets: the merged secrets UpdateK8sSecretsMetadata would send, as returned
+// by UpdateSecretMetadata, and the changes they make, as returned by ComputeChanges.
+// Neither the templates nor the existing secrets are modified.
+func MergeSecrets(templates []*corev1.Secret, existingSecrets []corev1.Secret, opts MergeOptions) ([]*corev1.Secret, []Change, error) {
+	changes, err := ComputeChanges(templates, existingSecrets, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged, err := UpdateSecretMetadata(templates, existingSecrets, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, changes, nil
+}
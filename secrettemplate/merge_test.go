@@ -0,0 +1,62 @@
+package secrettemplate
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestUpdateSecretMetadataMatchesEverySecret(t *testing.T) {
+	existing := []corev1.Secret{
+		*metaSecret("default", "app-a", nil, map[string]string{"tier": "web"}),
+		*metaSecret("default", "app-b", nil, map[string]string{"tier": "db"}),
+		*metaSecret("default", "db", nil, map[string]string{"tier": "db"}),
+		*metaSecret("other", "app-c", nil, map[string]string{"tier": "web"}),
+	}
+	tests := []struct {
+		name     string
+		template *corev1.Secret
+		opts     MergeOptions
+		want     map[string]string
+	}{
+		{
+			name:     "glob updates every matching secret in its namespace",
+			template: metaSecret("default", "apps", map[string]string{matchNameDirective: "app-*", "owner": "team-a"}, nil),
+			want:     map[string]string{"default/app-a": "team-a", "default/app-b": "team-a"},
+		},
+		{
+			name:     "selector updates every matching secret in its namespace",
+			template: metaSecret("default", "dbs", map[string]string{matchLabelsDirective: "tier=db", "owner": "team-a"}, nil),
+			want:     map[string]string{"default/app-b": "team-a", "default/db": "team-a"},
+		},
+		{
+			name:     "templating renders per matched secret",
+			template: metaSecret("default", "apps", map[string]string{matchNameDirective: "app-*", "owner": "{{ .Secret.Name }}"}, nil),
+			opts:     MergeOptions{Templating: true},
+			want:     map[string]string{"default/app-a": "app-a", "default/app-b": "app-b"},
+		},
+		{
+			name:     "name template updates only its secret",
+			template: metaSecret("default", "db", map[string]string{"owner": "team-a"}, nil),
+			want:     map[string]string{"default/db": "team-a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secrets := applyRun(t, []*corev1.Secret{tt.template}, existing, tt.opts)
+			got := make(map[string]string)
+			for key, s := range secrets {
+				if owner, ok := s.Annotations["owner"]; ok {
+					got[key] = owner
+				}
+				if _, ok := s.Annotations[matchNameDirective]; ok {
+					t.Errorf("secret %s got the match directive", key)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("owner annotations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
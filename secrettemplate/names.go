@@ -0,0 +1,59 @@
+package secrettemplate
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// trimNames strips surrounding whitespace from the template's namespace and name, which
+// would otherwise never match an existing secret, warning when any is found
+func trimNames(t *corev1.Secret, file string) {
+	ns, name := strings.TrimSpace(t.Namespace), strings.TrimSpace(t.Name)
+	if ns != t.Namespace || name != t.Name {
+		log.WithField("action", "trimNames").Warnf("%s: trimmed whitespace from secret %q/%q", file, t.Namespace, t.Name)
+	}
+	t.Namespace, t.Name = ns, name
+}
+
+// ResolveNameCase looks for existing secrets whose name differs only in case from a name
+// matched template which matches no secret exactly. Secret names are case sensitive, so
+// such a template is only renamed to the existing secret's name if ignoreCase is set, and
+// otherwise a warning is logged.
+func ResolveNameCase(templates []*corev1.Secret, existingSecrets []corev1.Secret, ignoreCase bool) {
+	l := log.WithFields(log.Fields{
+		"action": "ResolveNameCase",
+	})
+	for _, t := range templates {
+		if !IsNameTemplate(t) || len(MatchingSecrets(t, existingSecrets)) > 0 {
+			continue
+		}
+		for _, rs := range existingSecrets {
+			if rs.Namespace != t.Namespace || !strings.EqualFold(rs.Name, t.Name) {
+				continue
+			}
+			if ignoreCase {
+				l.Printf("template %s/%s matches secret %s by case-insensitive name", t.Namespace, t.Name, rs.Name)
+				t.Name = rs.Name
+			} else {
+				l.Warnf("template %s/%s matches no secret, but secret %s differs only in case", t.Namespace, t.Name, rs.Name)
+			}
+			break
+		}
+	}
+}
+
+// ApplyNameAffixes adds the prefix and suffix to the names of the name matched templates,
+// mapping logical template names onto the names of the cluster's secrets. Templates
+// matching by directive, such as a name glob, are left unchanged.
+func ApplyNameAffixes(templates []*corev1.Secret, prefix string, suffix string) {
+	if prefix == "" && suffix == "" {
+		return
+	}
+	for _, t := range templates {
+		if IsNameTemplate(t) {
+			t.Name = prefix + t.Name + suffix
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package secrettemplate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// warnings returns the messages of the warnings the hook captured
+func warnings(hook *logtest.Hook) []string {
+	var msgs []string
+	for _, e := range hook.AllEntries() {
+		if e.Level == log.WarnLevel {
+			msgs = append(msgs, e.Message)
+		}
+	}
+	return msgs
+}
+
+func TestParseSecretsTrimsNames(t *testing.T) {
+	tests := []struct {
+		name          string
+		namespace     string
+		secretName    string
+		wantNamespace string
+		wantName      string
+		wantWarning   bool
+	}{
+		{name: "clean", namespace: "default", secretName: "app", wantNamespace: "default", wantName: "app"},
+		{name: "trailing space in name", namespace: "default", secretName: "app ", wantNamespace: "default", wantName: "app", wantWarning: true},
+		{name: "surrounding space in namespace", namespace: " default ", secretName: "app", wantNamespace: "default", wantName: "app", wantWarning: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := logtest.NewGlobal()
+			defer hook.Reset()
+			content := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: \"" + tt.secretName + "\"\n  namespace: \"" + tt.namespace + "\"\n"
+			secrets, err := ParseSecrets("secrets.yaml", content, ParseOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(secrets) != 1 {
+				t.Fatalf("parsed %d secrets, want 1", len(secrets))
+			}
+			if secrets[0].Namespace != tt.wantNamespace || secrets[0].Name != tt.wantName {
+				t.Errorf("secret = %q/%q, want %q/%q", secrets[0].Namespace, secrets[0].Name, tt.wantNamespace, tt.wantName)
+			}
+			warned := false
+			for _, w := range warnings(hook) {
+				warned = warned || strings.Contains(w, "trimmed whitespace")
+			}
+			if warned != tt.wantWarning {
+				t.Errorf("warned = %v, want %v, warnings %v", warned, tt.wantWarning, warnings(hook))
+			}
+		})
+	}
+}
+
+func TestResolveNameCase(t *testing.T) {
+	existing := []corev1.Secret{*metaSecret("default", "App-TLS", nil, nil), *metaSecret("default", "db", nil, nil)}
+	tests := []struct {
+		name        string
+		template    string
+		ignoreCase  bool
+		wantName    string
+		wantWarning bool
+	}{
+		{name: "exact match", template: "db", wantName: "db"},
+		{name: "case-only mismatch warns", template: "app-tls", wantName: "app-tls", wantWarning: true},
+		{name: "case-only mismatch with ignore case", template: "app-tls", ignoreCase: true, wantName: "App-TLS"},
+		{name: "no match at all", template: "other", wantName: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := logtest.NewGlobal()
+			defer hook.Reset()
+			tmpl := metaSecret("default", tt.template, nil, nil)
+			ResolveNameCase([]*corev1.Secret{tmpl}, existing, tt.ignoreCase)
+			if tmpl.Name != tt.wantName {
+				t.Errorf("name = %s, want %s", tmpl.Name, tt.wantName)
+			}
+			if warned := len(warnings(hook)) > 0; warned != tt.wantWarning {
+				t.Errorf("warned = %v, want %v", warned, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestApplyNameAffixes(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		suffix string
+		want   []string
+	}{
+		{name: "no affixes", want: []string{"app", "app-*"}},
+		{name: "prefix", prefix: "prod-", want: []string{"prod-app", "app-*"}},
+		{name: "suffix", suffix: "-v2", want: []string{"app-v2", "app-*"}},
+		{name: "prefix and suffix", prefix: "prod-", suffix: "-v2", want: []string{"prod-app-v2", "app-*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates := []*corev1.Secret{
+				metaSecret("default", "app", nil, nil),
+				metaSecret("default", "app-*", map[string]string{matchNameDirective: "app-*"}, nil),
+			}
+			ApplyNameAffixes(templates, tt.prefix, tt.suffix)
+			var got []string
+			for _, s := range templates {
+				got = append(got, s.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("names = %q, want %q", got, tt.want)
+			}
+			if g := templates[1].Annotations[matchNameDirective]; g != "app-*" {
+				t.Errorf("glob = %q, want it unchanged", g)
+			}
+		})
+	}
+}
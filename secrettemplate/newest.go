@@ -0,0 +1,41 @@
+package secrettemplate
+
+import (
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// newestSecret returns the secret created last, of those created in the same second the
+// one with the greatest name
+func newestSecret(secrets []corev1.Secret) *corev1.Secret {
+	var newest *corev1.Secret
+	for i := range secrets {
+		s := &secrets[i]
+		if newest == nil || newest.CreationTimestamp.Before(&s.CreationTimestamp) ||
+			(newest.CreationTimestamp.Equal(&s.CreationTimestamp) && s.Name > newest.Name) {
+			newest = s
+		}
+	}
+	return newest
+}
+
+// SelectNewest replaces each template matching several existing secrets, by a glob or
+// selector, with a copy applying to the newest of them by name. Templates matching one
+// secret or none are returned as they are.
+func SelectNewest(templates []*corev1.Secret, existingSecrets []corev1.Secret) []*corev1.Secret {
+	l := log.WithFields(log.Fields{
+		"action": "SelectNewest",
+	})
+	selected := make([]*corev1.Secret, 0, len(templates))
+	for _, t := range templates {
+		matches := MatchingSecrets(t, existingSecrets)
+		if len(matches) < 2 {
+			selected = append(selected, t)
+			continue
+		}
+		newest := newestSecret(matches)
+		l.Printf("template %s/%s matches %d secrets, applying to the newest: %s", t.Namespace, t.Name, len(matches), newest.Name)
+		selected = append(selected, secretTemplate(t, newest))
+	}
+	return selected
+}
@@ -0,0 +1,82 @@
+package secrettemplate
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// createdSecret returns a secret created the given number of seconds after a fixed time
+func createdSecret(ns, name string, seconds int) corev1.Secret {
+	s := metaSecret(ns, name, nil, nil)
+	s.CreationTimestamp = metav1.NewTime(time.Date(2021, 6, 1, 10, 0, seconds, 0, time.UTC))
+	return *s
+}
+
+// labeled returns the secret with the tier=web label
+func labeled(s corev1.Secret) corev1.Secret {
+	s.Labels = map[string]string{"tier": "web"}
+	return s
+}
+
+func TestSelectNewest(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []corev1.Secret
+		template *corev1.Secret
+		want     string
+	}{
+		{
+			name:     "newest of several glob matches",
+			existing: []corev1.Secret{createdSecret("default", "app-1", 10), createdSecret("default", "app-3", 30), createdSecret("default", "app-2", 20)},
+			template: metaSecret("default", "apps", map[string]string{matchNameDirective: "app-*"}, nil),
+			want:     "app-3",
+		},
+		{
+			name:     "same second ties break on the greatest name",
+			existing: []corev1.Secret{createdSecret("default", "app-b", 10), createdSecret("default", "app-c", 10), createdSecret("default", "app-a", 10)},
+			template: metaSecret("default", "apps", map[string]string{matchNameDirective: "app-*"}, nil),
+			want:     "app-c",
+		},
+		{
+			name:     "newer secrets outside the namespace are ignored",
+			existing: []corev1.Secret{createdSecret("default", "app-1", 10), createdSecret("default", "app-2", 20), createdSecret("other", "app-3", 30)},
+			template: metaSecret("default", "apps", map[string]string{matchNameDirective: "app-*"}, nil),
+			want:     "app-2",
+		},
+		{
+			name:     "newest of several selector matches",
+			existing: []corev1.Secret{labeled(createdSecret("default", "web-1", 20)), labeled(createdSecret("default", "web-2", 10)), createdSecret("default", "db", 30)},
+			template: metaSecret("default", "web", map[string]string{matchLabelsDirective: "tier=web"}, nil),
+			want:     "web-1",
+		},
+		{
+			name:     "single match is returned as is",
+			existing: []corev1.Secret{createdSecret("default", "app-1", 10), createdSecret("default", "db", 20)},
+			template: metaSecret("default", "apps", map[string]string{matchNameDirective: "app-*"}, nil),
+			want:     "apps",
+		},
+		{
+			name:     "no match is returned as is",
+			existing: []corev1.Secret{createdSecret("default", "db", 20)},
+			template: metaSecret("default", "apps", map[string]string{matchNameDirective: "app-*"}, nil),
+			want:     "apps",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected := SelectNewest([]*corev1.Secret{tt.template}, tt.existing)
+			if len(selected) != 1 {
+				t.Fatalf("got %d templates, want 1", len(selected))
+			}
+			if selected[0].Name != tt.want {
+				t.Errorf("selected %s, want %s", selected[0].Name, tt.want)
+			}
+			if tt.want != tt.template.Name && !IsNameTemplate(selected[0]) {
+				t.Errorf("selected template still matches by directive: %v", selected[0].Annotations)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package secrettemplate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// how ResolveOverlaps reports an existing secret matched by several templates
+const (
+	OverlapMerge = "merge"
+	OverlapWarn  = "warn"
+	OverlapError = "error"
+)
+
+// matchDirectives are the directives selecting the secrets a template applies to
+var matchDirectives = []string{matchNameDirective, matchLabelsDirective, matchAnnotationDirective, matchOwnerDirective, matchExpressionDirective}
+
+// secretTemplate returns a copy of the template applying to the secret by name
+func secretTemplate(t *corev1.Secret, secret *corev1.Secret) *corev1.Secret {
+	c := t.DeepCopy()
+	c.Name = secret.Name
+	for _, d := range matchDirectives {
+		delete(c.Annotations, d)
+	}
+	return c
+}
+
+// ResolveOverlaps merges the templates matching the same existing secret, so every secret
+// is updated by a single template and the result does not depend on the order the
+// patches are applied in. Each template involved in an overlap is replaced by a template
+// per secret it matches, and the templates of a secret are merged in precedence order:
+// directive matched templates in the order given, then the template of the secret's
+// name, later ones overriding the keys of earlier ones. Overlaps are logged, as a warning
+// with OverlapWarn, and are an error with OverlapError.
+func ResolveOverlaps(templates []*corev1.Secret, existingSecrets []corev1.Secret, mode string) ([]*corev1.Secret, error) {
+	l := log.WithFields(log.Fields{
+		"action": "ResolveOverlaps",
+	})
+	matches := make([][]corev1.Secret, len(templates))
+	byName := make(map[string][]int)
+	for i, t := range templates {
+		matches[i] = MatchingSecrets(t, existingSecrets)
+		for _, rs := range matches[i] {
+			key := rs.Namespace + "/" + rs.Name
+			byName[key] = append(byName[key], i)
+		}
+	}
+	involved := make(map[int]bool)
+	var overlaps []string
+	for _, key := range sortedOverlapKeys(byName) {
+		var names []string
+		for _, i := range byName[key] {
+			involved[i] = true
+			names = append(names, templates[i].Name)
+		}
+		overlaps = append(overlaps, fmt.Sprintf("%s matched by templates %s", key, strings.Join(names, ", ")))
+	}
+	if len(overlaps) == 0 {
+		return templates, nil
+	}
+	for _, o := range overlaps {
+		switch mode {
+		case OverlapWarn:
+			l.Warnf("secret %s, merging them", o)
+		default:
+			l.Printf("secret %s, merging them", o)
+		}
+	}
+	if mode == OverlapError {
+		return nil, fmt.Errorf("%d secrets are matched by several templates: %s", len(overlaps), strings.Join(overlaps, "; "))
+	}
+	var resolved []*corev1.Secret
+	merged := make(map[string]*corev1.Secret)
+	add := func(t *corev1.Secret, rs *corev1.Secret) {
+		key := rs.Namespace + "/" + rs.Name
+		if m, ok := merged[key]; ok {
+			mergeTemplate(m, secretTemplate(t, rs))
+			return
+		}
+		m := secretTemplate(t, rs)
+		merged[key] = m
+		resolved = append(resolved, m)
+	}
+	// directive matched templates first, so the secret's own name template takes precedence
+	for _, nameTemplates := range []bool{false, true} {
+		for i, t := range templates {
+			if !involved[i] || IsNameTemplate(t) != nameTemplates {
+				continue
+			}
+			for j := range matches[i] {
+				add(t, &matches[i][j])
+			}
+		}
+	}
+	for i, t := range templates {
+		if !involved[i] {
+			resolved = append(resolved, t)
+		}
+	}
+	return resolved, nil
+}
+
+// sortedOverlapKeys returns the sorted secret keys matched by more than one template
+func sortedOverlapKeys(byName map[string][]int) []string {
+	var keys []string
+	for k, ts := range byName {
+		if len(ts) > 1 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,101 @@
+package secrettemplate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestResolveOverlaps(t *testing.T) {
+	existing := []corev1.Secret{
+		*metaSecret("default", "app-a", nil, nil),
+		*metaSecret("default", "app-b", nil, nil),
+		*metaSecret("default", "other", nil, nil),
+	}
+	templates := func() []*corev1.Secret {
+		return []*corev1.Secret{
+			metaSecret("default", "app-a", map[string]string{"x": "name"}, nil),
+			metaSecret("default", "glob", map[string]string{matchNameDirective: "app-*", "x": "glob", "y": "glob"}, nil),
+			metaSecret("default", "other", map[string]string{"z": "other"}, nil),
+		}
+	}
+	tests := []struct {
+		name         string
+		mode         string
+		want         map[string]map[string]string
+		wantWarnings int
+		wantError    string
+	}{
+		{
+			name: "merge",
+			mode: OverlapMerge,
+			want: map[string]map[string]string{
+				"app-a": {"x": "name", "y": "glob"},
+				"app-b": {"x": "glob", "y": "glob"},
+				"other": {"z": "other"},
+			},
+		},
+		{
+			name: "warn",
+			mode: OverlapWarn,
+			want: map[string]map[string]string{
+				"app-a": {"x": "name", "y": "glob"},
+				"app-b": {"x": "glob", "y": "glob"},
+				"other": {"z": "other"},
+			},
+			wantWarnings: 1,
+		},
+		{
+			name:      "error",
+			mode:      OverlapError,
+			wantError: "default/app-a matched by templates app-a, glob",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := logtest.NewGlobal()
+			defer hook.Reset()
+			resolved, err := ResolveOverlaps(templates(), existing, tt.mode)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("err = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]map[string]string)
+			for _, r := range resolved {
+				if _, ok := got[r.Name]; ok {
+					t.Errorf("secret %s has several templates", r.Name)
+				}
+				got[r.Name] = r.Annotations
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolved = %v, want %v", got, tt.want)
+			}
+			if w := warnings(hook); len(w) != tt.wantWarnings {
+				t.Errorf("warnings = %q, want %d", w, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestResolveOverlapsWithoutOverlap(t *testing.T) {
+	existing := []corev1.Secret{*metaSecret("default", "app-a", nil, nil)}
+	templates := []*corev1.Secret{
+		metaSecret("default", "glob", map[string]string{matchNameDirective: "app-*"}, nil),
+		metaSecret("default", "missing", nil, nil),
+	}
+	resolved, err := ResolveOverlaps(templates, existing, OverlapError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resolved, templates) {
+		t.Errorf("templates without overlaps were rewritten: %v", resolved)
+	}
+}
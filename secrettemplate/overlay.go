@@ -0,0 +1,55 @@
+package secrettemplate
+
+import (
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// MergeOverlay merges each overlay template into the base template of the same namespace
+// and name, its annotations, labels, data and stringData overriding the base's. Overlay
+// templates without a base template are appended.
+func MergeOverlay(base []*corev1.Secret, overlay []*corev1.Secret) []*corev1.Secret {
+	l := log.WithFields(log.Fields{
+		"action": "MergeOverlay",
+	})
+	merged := make([]*corev1.Secret, 0, len(base)+len(overlay))
+	index := make(map[string]*corev1.Secret, len(base))
+	for _, b := range base {
+		m := b.DeepCopy()
+		index[m.Namespace+"/"+m.Name] = m
+		merged = append(merged, m)
+	}
+	for _, o := range overlay {
+		b, ok := index[o.Namespace+"/"+o.Name]
+		if !ok {
+			l.Printf("overlay secret %s/%s has no base", o.Namespace, o.Name)
+			merged = append(merged, o)
+			continue
+		}
+		l.Printf("overlay secret %s/%s", o.Namespace, o.Name)
+		mergeTemplate(b, o)
+	}
+	return merged
+}
+
+// mergeTemplate merges the annotations, labels, data, stringData and type of o into b,
+// those of o taking precedence
+func mergeTemplate(b *corev1.Secret, o *corev1.Secret) {
+	b.Annotations = mergeAnnotations(b.Annotations, o.Annotations)
+	b.Labels = mergeLabels(b.Labels, o.Labels)
+	for k, v := range o.Data {
+		if b.Data == nil {
+			b.Data = make(map[string][]byte, len(o.Data))
+		}
+		b.Data[k] = v
+	}
+	for k, v := range o.StringData {
+		if b.StringData == nil {
+			b.StringData = make(map[string]string, len(o.StringData))
+		}
+		b.StringData[k] = v
+	}
+	if o.Type != "" {
+		b.Type = o.Type
+	}
+}
@@ -0,0 +1,253 @@
+package secrettemplate
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// GetSecretFiles returns the paths of the regular files in dir. If dir is itself a
+// regular file, it is the only file returned.
+func GetSecretFiles(dir string) []string {
+	if fi, err := os.Stat(dir); err == nil && fi.Mode().IsRegular() {
+		return []string{dir}
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		log.Errorf("Failed to read directory: %s", err)
+		return nil
+	}
+
+	var secretFiles []string
+	for _, file := range files {
+		if !file.IsDir() {
+			secretFiles = append(secretFiles, path.Join(dir, file.Name()))
+		}
+	}
+
+	return secretFiles
+}
+
+// ParseOptions controls how template files are preprocessed before decoding
+type ParseOptions struct {
+	ResolveIncludes bool
+	// StrictDecode rejects Secret manifests with unknown or duplicate fields
+	StrictDecode bool
+}
+
+// ParseFilesAsSecrets reads the template files and decodes the Secret documents they contain,
+// skipping documents of any other kind
+func ParseFilesAsSecrets(files []string, opts ParseOptions) ([]*corev1.Secret, error) {
+	log.WithFields(
+		log.Fields{
+			"action": "parseFilesAsSecrets",
+			"files":  len(files),
+		}).Print("parseFilesAsSecrets")
+	return ParseSource(&FileSource{Files: files, ResolveIncludes: opts.ResolveIncludes}, opts)
+}
+
+// stripServerMetadata clears the fields the API server manages from a template, which
+// templates copied from a live secret carry and which would otherwise leak into the
+// patches, e.g. a stale resourceVersion failing them with a conflict
+func stripServerMetadata(t *corev1.Secret, file string) {
+	var stripped []string
+	if t.ResourceVersion != "" {
+		stripped, t.ResourceVersion = append(stripped, "resourceVersion"), ""
+	}
+	if t.UID != "" {
+		stripped, t.UID = append(stripped, "uid"), ""
+	}
+	if !t.CreationTimestamp.IsZero() {
+		stripped, t.CreationTimestamp = append(stripped, "creationTimestamp"), metav1.Time{}
+	}
+	if len(t.ManagedFields) > 0 {
+		stripped, t.ManagedFields = append(stripped, "managedFields"), nil
+	}
+	if t.Generation != 0 {
+		stripped, t.Generation = append(stripped, "generation"), 0
+	}
+	if t.SelfLink != "" {
+		stripped, t.SelfLink = append(stripped, "selfLink"), ""
+	}
+	if t.DeletionTimestamp != nil || t.DeletionGracePeriodSeconds != nil {
+		stripped, t.DeletionTimestamp, t.DeletionGracePeriodSeconds = append(stripped, "deletionTimestamp"), nil, nil
+	}
+	if len(stripped) > 0 {
+		log.WithField("action", "stripServerMetadata").Warnf("%s: secret %s/%s: ignoring server-managed metadata %s", file, t.Namespace, t.Name, strings.Join(stripped, ","))
+	}
+}
+
+// removeComments drops the lines starting with #
+func removeComments(content string) string {
+	lines := strings.Split(content, "\n")
+	var result []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "#") {
+			result = append(result, line)
+		}
+	}
+	return strings.Join(result, "\n")
+}
+
+// splitDocuments splits a multi-document YAML stream into its documents. A document
+// starts at a "---" marker line, which may carry content such as "--- !tag", and ends at
+// the next marker or a "..." document end marker. Lines between a "..." and the next
+// "---" are not part of any document, and "---" within a value is not a marker.
+func splitDocuments(content string) []string {
+	var docs []string
+	var doc []string
+	inDoc := true
+	for _, line := range strings.Split(content, "\n") {
+		marker := strings.TrimRight(line, " \t\r")
+		switch {
+		case marker == "---" || strings.HasPrefix(line, "--- "):
+			docs = append(docs, strings.Join(doc, "\n"))
+			doc, inDoc = nil, true
+			if rest := strings.TrimPrefix(marker, "---"); strings.TrimSpace(rest) != "" {
+				doc = append(doc, strings.TrimSpace(rest))
+			}
+		case marker == "...":
+			docs = append(docs, strings.Join(doc, "\n"))
+			doc, inDoc = nil, false
+		case inDoc:
+			doc = append(doc, line)
+		}
+	}
+	return append(docs, strings.Join(doc, "\n"))
+}
+
+// SecretNamespaces returns the distinct namespaces of the secrets, in the order first seen
+func SecretNamespaces(secrets []*corev1.Secret) []string {
+	var namespaces []string
+secretsLoop:
+	for _, secret := range secrets {
+		for _, n := range namespaces {
+			if secret.Namespace == n {
+				continue secretsLoop
+			}
+		}
+		namespaces = append(namespaces, secret.Namespace)
+	}
+	return namespaces
+}
+
+// DedupeSecrets removes secrets with a UID already seen, preserving order
+func DedupeSecrets(secrets []corev1.Secret) []corev1.Secret {
+	seen := make(map[types.UID]bool, len(secrets))
+	var deduped []corev1.Secret
+	for _, s := range secrets {
+		if s.UID != "" && seen[s.UID] {
+			continue
+		}
+		seen[s.UID] = true
+		deduped = append(deduped, s)
+	}
+	return deduped
+}
+
+// FilterSecretsSince returns the secrets created within the since duration
+func FilterSecretsSince(secrets []corev1.Secret, since time.Duration) []corev1.Secret {
+	l := log.WithFields(
+		log.Fields{
+			"action": "filterSecretsSince",
+			"since":  since.String(),
+		})
+	cutoff := time.Now().Add(-since)
+	var filtered []corev1.Secret
+	for _, s := range secrets {
+		if s.CreationTimestamp.Time.Before(cutoff) {
+			continue
+		}
+		filtered = append(filtered, s)
+	}
+	l.Printf("filtered out by age: %d", len(secrets)-len(filtered))
+	return filtered
+}
+
+// FilterSecretsChangedSince returns the secrets created or written after t, judged by
+// their creation timestamp and the times of their managedFields entries. Secrets without
+// managedFields are always returned, as their last write is unknown.
+func FilterSecretsChangedSince(secrets []corev1.Secret, t time.Time) []corev1.Secret {
+	l := log.WithFields(
+		log.Fields{
+			"action": "filterSecretsChangedSince",
+			"since":  t.Format(time.RFC3339),
+		})
+	var filtered []corev1.Secret
+	for _, s := range secrets {
+		changed := len(s.ManagedFields) == 0 || s.CreationTimestamp.Time.After(t)
+		for _, mf := range s.ManagedFields {
+			if mf.Time != nil && mf.Time.Time.After(t) {
+				changed = true
+			}
+		}
+		if changed {
+			filtered = append(filtered, s)
+		}
+	}
+	l.Printf("filtered out as unchanged: %d", len(secrets)-len(filtered))
+	return filtered
+}
+
+// ParseSecrets decodes the Secret documents of content read from file, skipping documents
+// of any other kind. file is used in errors and to resolve annotation sources.
+func ParseSecrets(file string, content string, opts ParseOptions) ([]*corev1.Secret, error) {
+	l := log.WithFields(
+		log.Fields{
+			"action": "parseSecrets",
+			"file":   file,
+		})
+	var secrets []*corev1.Secret
+	content = removeComments(content)
+	docs := splitDocuments(content)
+	for _, doc := range docs {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		if err := validateSecretData([]byte(doc)); err != nil {
+			log.Errorf("Failed to validate secret: %s", err)
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		decode := scheme.Codecs.UniversalDeserializer().Decode
+		object, _, err := decode([]byte(doc), nil, nil)
+		if err != nil {
+			log.Errorf("Failed to decode secret: %s", err)
+			return nil, err
+		}
+		if object.GetObjectKind().GroupVersionKind() == corev1.SchemeGroupVersion.WithKind("Secret") {
+			s, ok := object.(*corev1.Secret)
+			if !ok {
+				l.Printf("object is not a secret")
+				return nil, fmt.Errorf("unexpected object type: %T", object)
+			}
+			trimNames(s, file)
+			stripServerMetadata(s, file)
+			l.Printf("secret: %s/%s", s.Namespace, s.Name)
+			if opts.StrictDecode {
+				if err := strictDecodeSecret([]byte(doc)); err != nil {
+					log.Errorf("Failed to decode secret: %s", err)
+					return nil, fmt.Errorf("%s: secret %s/%s: %w", file, s.Namespace, s.Name, err)
+				}
+			}
+			if err := validateDirectives(s); err != nil {
+				log.Errorf("Failed to validate secret: %s", err)
+				return nil, err
+			}
+			if err := resolveAnnotationSources(s, file); err != nil {
+				log.Errorf("Failed to resolve annotation: %s", err)
+				return nil, err
+			}
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets, nil
+}
@@ -0,0 +1,182 @@
+package secrettemplate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestDedupeSecrets(t *testing.T) {
+	secret := func(name string, uid types.UID) corev1.Secret {
+		return corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: uid}}
+	}
+	tests := []struct {
+		name    string
+		secrets []corev1.Secret
+		want    []string
+	}{
+		{name: "no duplicates", secrets: []corev1.Secret{secret("a", "1"), secret("b", "2")}, want: []string{"a", "b"}},
+		{name: "duplicate keeps first", secrets: []corev1.Secret{secret("a", "1"), secret("b", "2"), secret("a", "1")}, want: []string{"a", "b"}},
+		{name: "same name different uid", secrets: []corev1.Secret{secret("a", "1"), secret("a", "2")}, want: []string{"a", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DedupeSecrets(tt.secrets)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d secrets, want %d", len(got), len(tt.want))
+			}
+			for i, s := range got {
+				if s.Name != tt.want[i] {
+					t.Errorf("secret %d = %s, want %s", i, s.Name, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.yaml", "b.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("---\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{name: "directory", path: dir, want: []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")}},
+		{name: "single file", path: filepath.Join(dir, "b.yaml"), want: []string{filepath.Join(dir, "b.yaml")}},
+		{name: "missing path", path: filepath.Join(dir, "missing.yaml"), want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetSecretFiles(tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetSecretFiles(%s) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitDocuments(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{name: "single document", content: "a: 1\n", want: []string{"a: 1\n"}},
+		{name: "leading marker", content: "---\na: 1\n", want: []string{"", "a: 1\n"}},
+		{name: "separated documents", content: "a: 1\n---\nb: 2", want: []string{"a: 1", "b: 2"}},
+		{name: "marker with trailing space", content: "a: 1\n---  \r\nb: 2", want: []string{"a: 1", "b: 2"}},
+		{name: "marker with content", content: "--- !tag\nb: 2", want: []string{"", "!tag\nb: 2"}},
+		{name: "document end marker", content: "a: 1\n...\n---\nb: 2", want: []string{"a: 1", "", "b: 2"}},
+		{name: "lines after document end are dropped", content: "a: 1\n...\n# trailing comment\n---\nb: 2", want: []string{"a: 1", "", "b: 2"}},
+		{name: "marker inside a value", content: "a: |\n  ---\n  x\n", want: []string{"a: |\n  ---\n  x\n"}},
+		{name: "dashes prefix is not a marker", content: "a: 1\n----\n", want: []string{"a: 1\n----\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitDocuments(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitDocuments() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSecretsDocumentMarkers(t *testing.T) {
+	content := `---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: a
+  namespace: default
+...
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: b
+  namespace: default
+  annotations:
+    note: "---"
+...
+`
+	secrets, err := ParseSecrets("secrets.yaml", content, ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range secrets {
+		names = append(names, s.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("names = %q, want [a b]", names)
+	}
+}
+
+func TestParseSecretsStripsServerMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata string
+		want     string
+	}{
+		{name: "clean template", metadata: ""},
+		{name: "resourceVersion", metadata: "  resourceVersion: \"12345\"\n", want: "resourceVersion"},
+		{
+			name: "copied from a live secret",
+			metadata: `  resourceVersion: "12345"
+  uid: 0b8e1c3a-7a4f-4a9e-9d5e-2f0c1e8b6a11
+  creationTimestamp: "2021-06-01T10:00:00Z"
+  generation: 2
+  selfLink: /api/v1/namespaces/default/secrets/app
+  managedFields:
+  - manager: kubectl
+    operation: Update
+`,
+			want: "resourceVersion,uid,creationTimestamp,managedFields,generation,selfLink",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := logtest.NewGlobal()
+			defer hook.Reset()
+			content := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: app\n  namespace: default\n" + tt.metadata +
+				"  annotations:\n    owner: team-a\n"
+			secrets, err := ParseSecrets("app.yaml", content, ParseOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(secrets) != 1 {
+				t.Fatalf("got %d secrets, want 1", len(secrets))
+			}
+			s := secrets[0]
+			if s.ResourceVersion != "" || s.UID != "" || !s.CreationTimestamp.IsZero() || s.ManagedFields != nil || s.Generation != 0 || s.SelfLink != "" {
+				t.Errorf("server metadata kept: %+v", s.ObjectMeta)
+			}
+			if s.Annotations["owner"] != "team-a" {
+				t.Errorf("annotations = %v, want the template's", s.Annotations)
+			}
+			w := warnings(hook)
+			if tt.want == "" {
+				if len(w) != 0 {
+					t.Errorf("warnings = %q, want none", w)
+				}
+				return
+			}
+			if len(w) != 1 || !strings.HasSuffix(w[0], "ignoring server-managed metadata "+tt.want) {
+				t.Errorf("warnings = %q, want one listing %s", w, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,485 @@
+package secrettemplate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// PatchOptions controls what is sent when patching secrets
+type PatchOptions struct {
+	IncludeData bool
+	// Concurrency is the maximum number of namespaces patched in parallel
+	Concurrency int
+	// Verify reads each changed secret back to confirm its metadata was applied
+	Verify bool
+	// Transactional verifies each patched secret and reverts it to its pre-patch metadata
+	// if the change did not stick
+	Transactional bool
+	// ServerDryRun sends every create and patch as a server-side dry run
+	ServerDryRun bool
+	// Atomic validates every change with a server-side dry run first, changing no secret
+	// unless all of them pass
+	Atomic bool
+	// FieldManager is the field manager secrets are written as, defaulting to FieldManager
+	FieldManager string
+	// ServerSideApply patches with server-side apply instead of a JSON merge patch, and
+	// ForceConflicts takes over fields another manager owns instead of failing the patch
+	ServerSideApply bool
+	ForceConflicts  bool
+	// BatchSize is the maximum number of secrets created or patched before pausing for
+	// BatchPause, unlimited when not positive
+	BatchSize  int
+	BatchPause time.Duration
+	// SerialNamespaces processes one namespace at a time. After each namespace with
+	// changes other than the last, the run pauses for NamespacePause and then calls
+	// NamespaceCheck, if set, stopping before the next namespace if the check fails or a
+	// secret of the namespace failed to patch.
+	SerialNamespaces bool
+	NamespacePause   time.Duration
+	NamespaceCheck   func(ctx context.Context, namespace string) error
+}
+
+// fieldManager returns the field manager secrets are written as
+func (o PatchOptions) fieldManager() string {
+	if o.FieldManager != "" {
+		return o.FieldManager
+	}
+	return FieldManager
+}
+
+// dryRun returns the DryRun option of the create and patch requests
+func (o PatchOptions) dryRun() []string {
+	if o.ServerDryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+// metadataPatch returns values for a merge patch, with nil values deleting the removed keys
+func metadataPatch(values map[string]string, remove []string) map[string]interface{} {
+	p := make(map[string]interface{}, len(values)+len(remove))
+	for k, v := range values {
+		p[k] = v
+	}
+	for _, k := range remove {
+		p[k] = nil
+	}
+	return p
+}
+
+// rebaseSecret returns the secret with the metadata of the live secret, as just re-read,
+// and the changed annotations and labels of the change applied on top of it
+func rebaseSecret(secret *corev1.Secret, live *corev1.Secret, change *Change) *corev1.Secret {
+	rebase := func(desired map[string]string, current map[string]string, changed []string, removed []string) map[string]string {
+		m := mergeAnnotations(nil, current)
+		for _, k := range changed {
+			m[k] = desired[k]
+		}
+		for _, k := range removed {
+			delete(m, k)
+		}
+		return m
+	}
+	rs := secret.DeepCopy()
+	rs.ResourceVersion = live.ResourceVersion
+	rs.Annotations = rebase(secret.Annotations, live.Annotations, change.Annotations, change.RemoveAnnotations)
+	rs.Labels = rebase(secret.Labels, live.Labels, change.Labels, change.RemoveLabels)
+	return rs
+}
+
+// isVersionConflict reports whether err is a resourceVersion conflict, as opposed to any
+// other conflict such as a server-side apply field manager conflict, which re-reading the
+// secret cannot resolve
+func isVersionConflict(err error) bool {
+	if !apierrors.IsConflict(err) {
+		return false
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Details != nil {
+		for _, c := range status.Status().Details.Causes {
+			if c.Type == metav1.CauseTypeFieldManagerConflict {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// retryOnVersionConflict calls send with the secret, and on a resourceVersion conflict
+// re-reads the live secret, applies the change on top of its metadata and calls send
+// with the result, a bounded number of times
+func retryOnVersionConflict(ctx context.Context, client kubernetes.Interface, secret *corev1.Secret, change *Change, l *log.Entry, send func(desired *corev1.Secret) error) error {
+	desired, attempt := secret, 0
+	return retry.OnError(retry.DefaultRetry, isVersionConflict, func() error {
+		if attempt++; attempt > 1 {
+			l.Printf("conflict, re-reading the secret (attempt %d)", attempt)
+			live, err := client.CoreV1().Secrets(secret.Namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			desired = rebaseSecret(secret, live, change)
+		}
+		return send(desired)
+	})
+}
+
+// PatchSecretMetadata merge patches the changed annotations and labels, and data if
+// opts.IncludeData is set, into the existing secret. A secret deleted in the meantime is
+// ignored. The patch is preconditioned on the resourceVersion of the secret, if set. On a
+// conflict the live secret is re-read, the change is applied on top of its metadata and
+// the patch is retried, a bounded number of times.
+func PatchSecretMetadata(ctx context.Context, client kubernetes.Interface, secret *corev1.Secret, change *Change, opts PatchOptions) error {
+	l := log.WithFields(
+		log.Fields{
+			"action": "patchSecretMetadata",
+			"secret": secret.Namespace + "/" + secret.Name,
+		},
+	)
+	l.Print("patchSecretMetadata")
+	sc := client.CoreV1().Secrets(secret.Namespace)
+	if opts.ServerSideApply {
+		return applySecretMetadata(ctx, client, secret, change, opts)
+	}
+	err := retryOnVersionConflict(ctx, client, secret, change, l, func(desired *corev1.Secret) error {
+		metadata := map[string]interface{}{
+			"annotations": metadataPatch(desired.Annotations, change.RemoveAnnotations),
+			"labels":      metadataPatch(desired.Labels, change.RemoveLabels),
+		}
+		if desired.ResourceVersion != "" {
+			metadata["resourceVersion"] = desired.ResourceVersion
+		}
+		patchData := map[string]interface{}{
+			"metadata": metadata,
+		}
+		if opts.IncludeData {
+			if data := SecretData(desired); data != nil {
+				patchData["data"] = data
+			}
+		}
+		jd, err := json.Marshal(patchData)
+		if err != nil {
+			l.Printf("json marshal error: %v", err)
+			return err
+		}
+		_, err = sc.Patch(ctx, secret.Name, types.MergePatchType, jd, metav1.PatchOptions{FieldManager: opts.fieldManager(), DryRun: opts.dryRun()})
+		return err
+	})
+	if err != nil {
+		// if it's not found, ignore. only a NotFound status is ignored, not every error
+		// which happens to mention "not found"
+		if apierrors.IsNotFound(err) {
+			l.Print("secret no longer exists, ignoring")
+			return nil
+		}
+		l.Printf("patch error: %v", err)
+		return ClassifyAPIError(err)
+	}
+	return nil
+}
+
+// appliedValues returns the values without the removed keys, for an apply configuration
+func appliedValues(values map[string]string, remove []string) map[string]string {
+	applied := make(map[string]string, len(values))
+	for k, v := range values {
+		applied[k] = v
+	}
+	for _, k := range remove {
+		delete(applied, k)
+	}
+	return applied
+}
+
+// applySecretMetadata server-side applies the merged annotations and labels, and data if
+// opts.IncludeData is set, as opts.FieldManager. Applying every merged key, not only the
+// changed ones, keeps the manager from dropping keys it applied before, and shares rather
+// than conflicts over the ownership of unchanged keys. Changed keys owned by another manager
+// fail the apply with ErrConflict unless opts.ForceConflicts is set. Like a merge patch,
+// the apply is preconditioned on the resourceVersion of the secret, if set, and retried
+// against the re-read secret on a resourceVersion conflict.
+func applySecretMetadata(ctx context.Context, client kubernetes.Interface, secret *corev1.Secret, change *Change, opts PatchOptions) error {
+	l := log.WithFields(
+		log.Fields{
+			"action": "applySecretMetadata",
+			"secret": secret.Namespace + "/" + secret.Name,
+		},
+	)
+	err := retryOnVersionConflict(ctx, client, secret, change, l, func(desired *corev1.Secret) error {
+		metadata := map[string]interface{}{
+			"name":        desired.Name,
+			"namespace":   desired.Namespace,
+			"annotations": appliedValues(desired.Annotations, change.RemoveAnnotations),
+			"labels":      appliedValues(desired.Labels, change.RemoveLabels),
+		}
+		if desired.ResourceVersion != "" {
+			metadata["resourceVersion"] = desired.ResourceVersion
+		}
+		applyData := map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   metadata,
+		}
+		if opts.IncludeData {
+			if data := SecretData(desired); data != nil {
+				applyData["data"] = data
+			}
+		}
+		jd, err := json.Marshal(applyData)
+		if err != nil {
+			l.Printf("json marshal error: %v", err)
+			return err
+		}
+		force := opts.ForceConflicts
+		_, err = client.CoreV1().Secrets(desired.Namespace).Patch(ctx, desired.Name, types.ApplyPatchType, jd, metav1.PatchOptions{
+			FieldManager: opts.fieldManager(),
+			Force:        &force,
+			DryRun:       opts.dryRun(),
+		})
+		return err
+	})
+	if err != nil {
+		l.Printf("apply error: %v", err)
+		return ClassifyAPIError(err)
+	}
+	return nil
+}
+
+// processSecret creates or patches a single secret as described by its change
+func processSecret(ctx context.Context, client kubernetes.Interface, secret *corev1.Secret, change *Change, opts PatchOptions) Result {
+	r := Result{Namespace: secret.Namespace, Name: secret.Name, Action: ActionPatched, Change: change}
+	if change == nil {
+		r.Action = ActionSkipped
+		return r
+	}
+	var err error
+	if change.Create {
+		var created bool
+		created, err = CreateSecret(ctx, client, secret, opts)
+		if created {
+			r.Action = ActionCreated
+		}
+		if err == nil && (opts.Verify || opts.Transactional) {
+			err = VerifySecret(ctx, client, secret, change)
+		}
+	} else if opts.Transactional {
+		// verifies, and reverts on failure, itself
+		err = patchTransactional(ctx, client, secret, change, opts)
+	} else {
+		err = PatchSecretMetadata(ctx, client, secret, change, opts)
+		if err == nil && opts.Verify {
+			err = VerifySecret(ctx, client, secret, change)
+		}
+	}
+	if err != nil {
+		r.Action = ActionError
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// UpdateK8sSecretsMetadata creates or patches the changed secrets. Namespaces are processed
+// in parallel, up to opts.Concurrency at a time, and the results are logged and recorded
+// grouped by namespace in the order the namespaces first appear in secrets. With
+// opts.BatchSize set, the secrets are processed in batches of that many changes, pausing
+// opts.BatchPause between them. With opts.SerialNamespaces set, each namespace is a batch
+// of its own, checked before the next one as checkNamespace describes.
+func UpdateK8sSecretsMetadata(ctx context.Context, client kubernetes.Interface, secrets []*corev1.Secret, changes []Change, opts PatchOptions) (*Summary, error) {
+	l := log.WithFields(
+		log.Fields{
+			"action":  "updateK8sSecretsMetadata",
+			"secrets": len(secrets),
+		})
+	l.Print("updateK8sSecretsMetadata")
+	if opts.Atomic {
+		vopts := opts
+		vopts.Atomic, vopts.ServerDryRun, vopts.Verify, vopts.Transactional = false, true, false, false
+		// the dry run changes nothing, so it is neither paced nor checked per namespace
+		vopts.SerialNamespaces = false
+		vopts.BatchSize, vopts.BatchPause = 0, 0
+		vs, err := UpdateK8sSecretsMetadata(ctx, client, secrets, changes, vopts)
+		if err != nil {
+			l.Errorf("validation failed, no secret was changed: %v", err)
+			return &Summary{Skipped: len(secrets) - vs.Errors, Errors: vs.Errors, Failures: vs.Failures},
+				fmt.Errorf("atomic validation failed, no secret was changed: %w", err)
+		}
+		l.Print("validation passed, applying")
+		opts.Atomic = false
+	}
+	summary := &Summary{}
+	batches := batchSecrets(secrets, changes, opts.BatchSize)
+	if opts.SerialNamespaces {
+		batches = batchNamespaces(secrets)
+	}
+	// prev is the number of results recorded before the last batch
+	prev := 0
+	for bi, batch := range batches {
+		if bi > 0 && opts.SerialNamespaces {
+			ns := batches[bi-1][0].Namespace
+			if err := checkNamespace(ctx, ns, summary.Results[prev:], opts); err != nil {
+				summary.StoppedAfter = ns
+				l.Errorf("stopped after namespace %s, %d namespaces not processed: %v", ns, len(batches)-bi, err)
+				return summary, fmt.Errorf("stopped after namespace %s, %d namespaces not processed: %w", ns, len(batches)-bi, err)
+			}
+		} else if bi > 0 {
+			l.Printf("batch %d of %d done, processed %d of %d secrets, pausing %s", bi, len(batches), len(summary.Results), len(secrets), opts.BatchPause)
+			select {
+			case <-ctx.Done():
+			case <-time.After(opts.BatchPause):
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		prev = len(summary.Results)
+		processNamespaces(ctx, client, batch, changes, opts, summary, l)
+	}
+	if err := ctx.Err(); err != nil {
+		l.Errorf("stopped after %d of %d secrets: %v", len(summary.Results), len(secrets), err)
+		return summary, err
+	}
+	if summary.Errors > 0 {
+		return summary, fmt.Errorf("%d secrets failed to patch", summary.Errors)
+	}
+	return summary, nil
+}
+
+// processNamespaces creates or patches the secrets, processing namespaces in parallel up to
+// opts.Concurrency at a time, and logs and records the results in summary grouped by
+// namespace in the order the namespaces first appear in secrets
+func processNamespaces(ctx context.Context, client kubernetes.Interface, secrets []*corev1.Secret, changes []Change, opts PatchOptions, summary *Summary, l *log.Entry) {
+	var namespaces []string
+	byNamespace := make(map[string][]*corev1.Secret)
+	for _, secret := range secrets {
+		if _, ok := byNamespace[secret.Namespace]; !ok {
+			namespaces = append(namespaces, secret.Namespace)
+		}
+		byNamespace[secret.Namespace] = append(byNamespace[secret.Namespace], secret)
+	}
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([][]Result, len(namespaces))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, ns := range namespaces {
+		wg.Add(1)
+		go func(i int, ns string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			for _, secret := range byNamespace[ns] {
+				if ctx.Err() != nil {
+					return
+				}
+				results[i] = append(results[i], processSecret(ctx, client, secret, FindChange(secret, changes), opts))
+			}
+		}(i, ns)
+	}
+	wg.Wait()
+	for i, ns := range namespaces {
+		nl := l.WithField("namespace", ns)
+		for _, r := range results[i] {
+			switch r.Action {
+			case ActionSkipped:
+				nl.Printf("skip unchanged secret: %s/%s", r.Namespace, r.Name)
+			case ActionError:
+				nl.Errorf("secret %s/%s error: %s", r.Namespace, r.Name, r.Error)
+			default:
+				nl.Printf("%s secret: %s/%s %s", r.Action, r.Namespace, r.Name, r.Change)
+			}
+			summary.record(r)
+		}
+	}
+}
+
+// batchNamespaces splits secrets into a batch per namespace, in the order the namespaces
+// first appear in secrets
+func batchNamespaces(secrets []*corev1.Secret) [][]*corev1.Secret {
+	var batches [][]*corev1.Secret
+	index := make(map[string]int)
+	for _, s := range secrets {
+		i, ok := index[s.Namespace]
+		if !ok {
+			i = len(batches)
+			index[s.Namespace] = i
+			batches = append(batches, nil)
+		}
+		batches[i] = append(batches[i], s)
+	}
+	if len(batches) == 0 {
+		return [][]*corev1.Secret{secrets}
+	}
+	return batches
+}
+
+// checkNamespace decides, from the results of its secrets, whether a serial run may go on
+// past the namespace. A namespace with a failed secret stops the run, and one with
+// changes is followed by opts.NamespacePause and opts.NamespaceCheck, neither of which
+// applies to server-side dry runs.
+func checkNamespace(ctx context.Context, namespace string, results []Result, opts PatchOptions) error {
+	l := log.WithFields(log.Fields{
+		"action":    "checkNamespace",
+		"namespace": namespace,
+	})
+	changed := false
+	for _, r := range results {
+		if r.Action == ActionError {
+			return fmt.Errorf("secrets of namespace %s failed to patch", namespace)
+		}
+		changed = changed || r.Action != ActionSkipped
+	}
+	if !changed || opts.ServerDryRun {
+		return nil
+	}
+	if opts.NamespacePause > 0 {
+		l.Printf("namespace done, pausing %s", opts.NamespacePause)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.NamespacePause):
+		}
+	}
+	if opts.NamespaceCheck == nil {
+		return nil
+	}
+	if err := opts.NamespaceCheck(ctx, namespace); err != nil {
+		return fmt.Errorf("namespace check failed: %w", err)
+	}
+	l.Print("namespace check passed")
+	return nil
+}
+
+// batchSecrets splits secrets into batches of up to size changed secrets each, keeping
+// their order. Unchanged secrets are not sent and do not count towards the size. A size
+// below one puts every secret in a single batch.
+func batchSecrets(secrets []*corev1.Secret, changes []Change, size int) [][]*corev1.Secret {
+	if size < 1 || len(secrets) == 0 {
+		return [][]*corev1.Secret{secrets}
+	}
+	var batches [][]*corev1.Secret
+	var batch []*corev1.Secret
+	n := 0
+	for _, s := range secrets {
+		if FindChange(s, changes) != nil {
+			if n == size {
+				batches = append(batches, batch)
+				batch, n = nil, 0
+			}
+			n++
+		}
+		batch = append(batch, s)
+	}
+	return append(batches, batch)
+}
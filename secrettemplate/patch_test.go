@@ -0,0 +1,120 @@
+package secrettemplate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// versionConflict is the error of a patch preconditioned on a stale resourceVersion
+func versionConflict() error {
+	return apierrors.NewConflict(schema.GroupResource{Resource: "secrets"}, "app", errors.New("the object has been modified"))
+}
+
+// fieldManagerConflict is the error of an apply changing fields another manager owns
+func fieldManagerConflict() error {
+	err := apierrors.NewConflict(schema.GroupResource{Resource: "secrets"}, "app", errors.New("conflict with \"kubectl\""))
+	err.ErrStatus.Details.Causes = []metav1.StatusCause{{Type: metav1.CauseTypeFieldManagerConflict, Field: ".metadata.annotations.owner"}}
+	return err
+}
+
+func TestPatchSecretMetadataConflict(t *testing.T) {
+	tests := []struct {
+		name      string
+		ssa       bool
+		errs      []error
+		wantErr   error
+		wantSends int
+		wantGets  int
+	}{
+		{name: "merge patch, no conflict", wantSends: 1},
+		{name: "merge patch, conflict then success", errs: []error{versionConflict()}, wantSends: 2, wantGets: 1},
+		{name: "apply, conflict then success", ssa: true, errs: []error{versionConflict()}, wantSends: 2, wantGets: 1},
+		{name: "apply, field manager conflict is not retried", ssa: true, errs: []error{fieldManagerConflict()}, wantErr: ErrConflict, wantSends: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// listed at resourceVersion 1, then changed by another writer
+			live := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "default",
+				Name:            "app",
+				ResourceVersion: "2",
+				Annotations:     map[string]string{"owner": "team-a", "other": "changed"},
+			}}
+			client := fake.NewSimpleClientset(live)
+			var sent []map[string]interface{}
+			gets := 0
+			client.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				gets++
+				return false, nil, nil
+			})
+			client.PrependReactor("patch", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				pa := action.(k8stesting.PatchAction)
+				var body map[string]interface{}
+				if err := json.Unmarshal(pa.GetPatch(), &body); err != nil {
+					t.Fatal(err)
+				}
+				sent = append(sent, body)
+				if len(sent) <= len(tt.errs) {
+					return true, nil, tt.errs[len(sent)-1]
+				}
+				if pa.GetPatchType() == types.ApplyPatchType {
+					// the fake object tracker cannot apply
+					return true, live, nil
+				}
+				return false, nil, nil
+			})
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "default",
+				Name:            "app",
+				ResourceVersion: "1",
+				Annotations:     map[string]string{"owner": "team-b", "other": "listed"},
+			}}
+			change := &Change{Namespace: "default", Name: "app", Annotations: []string{"owner"}}
+			err := PatchSecretMetadata(context.Background(), client, secret, change, PatchOptions{ServerSideApply: tt.ssa})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if len(sent) != tt.wantSends || gets != tt.wantGets {
+				t.Fatalf("sent %d patches after %d gets, want %d after %d", len(sent), gets, tt.wantSends, tt.wantGets)
+			}
+			metadata := func(i int) map[string]interface{} {
+				return sent[i]["metadata"].(map[string]interface{})
+			}
+			if rv := metadata(0)["resourceVersion"]; rv != "1" {
+				t.Errorf("first patch resourceVersion = %v, want the listed 1", rv)
+			}
+			if tt.wantGets == 0 {
+				return
+			}
+			last := metadata(len(sent) - 1)
+			if rv := last["resourceVersion"]; rv != "2" {
+				t.Errorf("retried patch resourceVersion = %v, want the re-read 2", rv)
+			}
+			annotations := last["annotations"].(map[string]interface{})
+			if annotations["owner"] != "team-b" || annotations["other"] != "changed" {
+				t.Errorf("retried patch annotations = %v, want the change on top of the re-read secret", annotations)
+			}
+			if tt.ssa {
+				return
+			}
+			got, err := client.CoreV1().Secrets("default").Get(context.Background(), "app", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Annotations["owner"] != "team-b" || got.Annotations["other"] != "changed" {
+				t.Errorf("annotations = %v, want owner=team-b and other=changed", got.Annotations)
+			}
+		})
+	}
+}
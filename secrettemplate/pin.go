@@ -0,0 +1,33 @@
+package secrettemplate
+
+import (
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// templateVersionDirective is a template annotation declaring the template's version
+	templateVersionDirective = "k8s-secret-template/template-version"
+	// PinVersionAnnotation, set on an existing secret, pins it to the template version of
+	// the same value. Templates declaring any other version, or none, skip the secret.
+	PinVersionAnnotation = "k8s-secret-template/pin-version"
+)
+
+// skipPinned returns the secrets which are not pinned to a template version other than
+// the template's
+func skipPinned(t *corev1.Secret, secrets []corev1.Secret) []corev1.Secret {
+	l := log.WithFields(log.Fields{
+		"action":   "skipPinned",
+		"template": t.Namespace + "/" + t.Name,
+	})
+	version := t.Annotations[templateVersionDirective]
+	var kept []corev1.Secret
+	for _, s := range secrets {
+		if pin, ok := s.Annotations[PinVersionAnnotation]; ok && pin != version {
+			l.Printf("skip secret %s/%s pinned to template version %q, template version is %q", s.Namespace, s.Name, pin, version)
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
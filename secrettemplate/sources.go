@@ -0,0 +1,45 @@
+package secrettemplate
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// fileSourcePrefix marks an annotation value to be read from a file
+	fileSourcePrefix = "@file:"
+	// base64SourcePrefix marks an annotation value to be base64 decoded
+	base64SourcePrefix = "@base64:"
+)
+
+// resolveAnnotationSources replaces annotation values of the form @file:path with the
+// content of path, resolved relative to the template file, and values of the form
+// @base64:... with their decoded content
+func resolveAnnotationSources(secret *corev1.Secret, file string) error {
+	for k, v := range secret.Annotations {
+		switch {
+		case strings.HasPrefix(v, fileSourcePrefix):
+			p := strings.TrimPrefix(v, fileSourcePrefix)
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(filepath.Dir(file), p)
+			}
+			fd, err := os.ReadFile(p)
+			if err != nil {
+				return fmt.Errorf("secret %s/%s annotation %q: %w", secret.Namespace, secret.Name, k, err)
+			}
+			secret.Annotations[k] = string(fd)
+		case strings.HasPrefix(v, base64SourcePrefix):
+			bd, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(v, base64SourcePrefix))
+			if err != nil {
+				return fmt.Errorf("secret %s/%s annotation %q is not valid base64: %w", secret.Namespace, secret.Name, k, err)
+			}
+			secret.Annotations[k] = string(bd)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package secrettemplate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// strictDecodeSecret decodes a Secret manifest, failing on unknown or duplicate fields
+// which the universal deserializer silently drops
+func strictDecodeSecret(doc []byte) error {
+	jd, err := yaml.YAMLToJSONStrict(doc)
+	if err != nil {
+		return fmt.Errorf("strict decode: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(jd))
+	dec.DisallowUnknownFields()
+	var s corev1.Secret
+	if err := dec.Decode(&s); err != nil {
+		return fmt.Errorf("strict decode: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package secrettemplate
+
+import "fmt"
+
+// actions recorded in a Result
+const (
+	ActionPatched = "patched"
+	ActionCreated = "created"
+	ActionSkipped = "skipped"
+	ActionError   = "error"
+)
+
+// Result is the outcome of processing a single secret
+type Result struct {
+	Namespace string
+	Name      string
+	Action    string
+	Change    *Change
+	Error     string
+}
+
+// Summary tallies the outcome of patching the parsed secrets
+type Summary struct {
+	// Templates is the number of templates parsed, and Matched the number of existing
+	// secrets they matched
+	Templates int      `json:"templates"`
+	Matched   int      `json:"matched"`
+	Changes   int      `json:"changes"`
+	Patched   int      `json:"patched"`
+	Created   int      `json:"created"`
+	Skipped   int      `json:"skipped"`
+	Errors    int      `json:"errors"`
+	Failures  []string `json:"failures,omitempty"`
+	// EmptyNamespaces are the namespaces checked without any matched or created secret,
+	// only recorded when requested
+	EmptyNamespaces []string `json:"emptyNamespaces,omitempty"`
+	// StoppedAfter is the namespace after which a serial run stopped, if it did
+	StoppedAfter string   `json:"stoppedAfter,omitempty"`
+	Results      []Result `json:"-"`
+}
+
+// record adds the result of a secret to the summary counts
+func (s *Summary) record(r Result) {
+	s.Results = append(s.Results, r)
+	switch r.Action {
+	case ActionPatched:
+		s.Patched++
+	case ActionCreated:
+		s.Created++
+	case ActionSkipped:
+		s.Skipped++
+	case ActionError:
+		s.Errors++
+		s.Failures = append(s.Failures, fmt.Sprintf("%s/%s: %s", r.Namespace, r.Name, r.Error))
+	}
+}
+
+// String renders the summary as a single key=value line
+func (s *Summary) String() string {
+	return fmt.Sprintf("patched=%d created=%d skipped=%d errors=%d", s.Patched, s.Created, s.Skipped, s.Errors)
+}
@@ -0,0 +1,112 @@
+package secrettemplate
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// secretFields are the fields of the matched secret available to value templates
+type secretFields struct {
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// templateData is the data value templates are executed against
+type templateData struct {
+	Secret secretFields
+	Values map[string]interface{}
+}
+
+// newTemplateData returns the template data for the target secret and the values
+func newTemplateData(target *corev1.Secret, values map[string]interface{}) templateData {
+	return templateData{
+		Secret: secretFields{
+			Name:        target.Name,
+			Namespace:   target.Namespace,
+			Labels:      target.Labels,
+			Annotations: target.Annotations,
+		},
+		Values: values,
+	}
+}
+
+// renderValues returns values with each value executed as a text/template against data.
+// Values without a template action are returned unchanged.
+func renderValues(values map[string]string, data templateData) (map[string]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+	rendered := make(map[string]string, len(values))
+	for k, v := range values {
+		if !strings.Contains(v, "{{") {
+			rendered[k] = v
+			continue
+		}
+		t, err := template.New(k).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", k, err)
+		}
+		var b bytes.Buffer
+		if err := t.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("template %s: %w", k, err)
+		}
+		rendered[k] = b.String()
+	}
+	return rendered, nil
+}
+
+// desiredMetadata returns the annotations and labels the template applies to the target
+// secret, rendering their values against it when opts.Templating is set and deep merging
+// annotation values into the target's when opts.MergeStrategy is MergeDeep. Annotations
+// derived by opts.LabelMappings are merged under the template's, and the target's
+// opts.Annotations over both, before deep merging. The opts.ListAnnotations values are
+// unioned with the target's. Entries failing validation are dropped, or are an error with
+// opts.StrictMetadata. With opts.Checksum, the annotations include the checksum of the
+// result.
+func desiredMetadata(t *corev1.Secret, target *corev1.Secret, opts MergeOptions) (map[string]string, map[string]string, error) {
+	a, lb := TemplateAnnotations(t), t.Labels
+	if opts.Templating {
+		data := newTemplateData(target, opts.Values)
+		var err error
+		if a, err = renderValues(a, data); err != nil {
+			return nil, nil, fmt.Errorf("secret %s/%s annotation %w", target.Namespace, target.Name, err)
+		}
+		if lb, err = renderValues(lb, data); err != nil {
+			return nil, nil, fmt.Errorf("secret %s/%s label %w", target.Namespace, target.Name, err)
+		}
+	}
+	if mapped := mappedAnnotations(opts.LabelMappings, target.Labels); mapped != nil {
+		// explicit template annotations take precedence over derived ones
+		a = mergeAnnotations(mapped, a)
+	}
+	if extra, ok := opts.Annotations[target.Namespace+"/"+target.Name]; ok {
+		a = mergeAnnotations(mergeAnnotations(nil, a), extra)
+	}
+	if opts.MergeStrategy == MergeDeep && target != t {
+		a = deepMergeAnnotations(target.Annotations, a)
+	}
+	if target != t {
+		a = listMergeAnnotations(target.Annotations, a, opts.ListAnnotations)
+	}
+	a, lb, err := validateMetadata(target, a, lb, opts.StrictMetadata)
+	if err != nil || !opts.Checksum {
+		return a, lb, err
+	}
+	return withChecksum(t, a, lb, opts), lb, nil
+}
+
+// MergeValues merges layered values, such as those of several values files, into one map
+// with later layers overriding earlier ones key by key
+func MergeValues(layers ...map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for _, v := range layers {
+		mergeJSONObjects(merged, v)
+	}
+	return merged
+}
@@ -0,0 +1,138 @@
+package secrettemplate
+
+import (
+	"strings"
+	"testing"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDesiredMetadataLabelValueTemplates(t *testing.T) {
+	target := metaSecret("default", "app", nil, map[string]string{"team": "payments"})
+	tests := []struct {
+		name      string
+		value     string
+		values    map[string]interface{}
+		strict    bool
+		want      string
+		wantSkip  bool
+		wantError string
+	}{
+		{name: "rendered from the secret", value: "{{ .Secret.Labels.team }}-{{ .Secret.Name }}", want: "payments-app"},
+		{name: "rendered from values", value: "{{ .Values.env }}", values: map[string]interface{}{"env": "prod"}, want: "prod"},
+		{name: "63 characters is valid", value: "{{ .Values.v }}", values: map[string]interface{}{"v": strings.Repeat("a", 63)}, want: strings.Repeat("a", 63)},
+		{name: "64 characters is skipped", value: "{{ .Values.v }}", values: map[string]interface{}{"v": strings.Repeat("a", 64)}, wantSkip: true},
+		{name: "64 characters fails under strict", value: "{{ .Values.v }}", values: map[string]interface{}{"v": strings.Repeat("a", 64)}, strict: true, wantError: "must be no more than 63 characters"},
+		{name: "invalid characters are skipped", value: "{{ .Secret.Name }}/v1", wantSkip: true},
+		{name: "invalid characters fail under strict", value: "{{ .Secret.Name }} v1", strict: true, wantError: `metadata.labels: Invalid value: "app v1"`},
+		{name: "leading dash fails under strict", value: "-{{ .Secret.Name }}", strict: true, wantError: "must start and end with an alphanumeric character"},
+		{name: "missing value fails", value: "{{ .Values.missing }}", values: map[string]interface{}{}, wantError: "secret default/app label template example.com/derived"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := logtest.NewGlobal()
+			defer hook.Reset()
+			tmpl := metaSecret("default", "app", nil, map[string]string{"example.com/derived": tt.value})
+			_, labels, err := desiredMetadata(tmpl, target, MergeOptions{Templating: true, Values: tt.values, StrictMetadata: tt.strict})
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("err = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := labels["example.com/derived"]
+			if tt.wantSkip {
+				if ok {
+					t.Errorf("invalid label value %q was kept", got)
+				}
+				if w := warnings(hook); len(w) != 1 || !strings.Contains(w[0], "skipping invalid metadata") {
+					t.Errorf("warnings = %q, want one skipping invalid metadata warning", w)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("label = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDesiredMetadataWithoutTemplating(t *testing.T) {
+	tmpl := metaSecret("default", "app", map[string]string{"a": "{{ .Secret.Name }}"}, nil)
+	a, _, err := desiredMetadata(tmpl, &corev1.Secret{}, MergeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a["a"] != "{{ .Secret.Name }}" {
+		t.Errorf("annotation = %q, want the template text unrendered", a["a"])
+	}
+}
+
+func TestDesiredMetadataAnnotationsPrecedence(t *testing.T) {
+	target := metaSecret("default", "app", map[string]string{"a": "existing"}, map[string]string{"tier": "gold"})
+	mappings := []LabelMapping{{SourceLabel: "tier", TargetAnnotation: "a", Values: map[string]string{"gold": "mapped"}}}
+	tests := []struct {
+		name     string
+		template map[string]string
+		opts     MergeOptions
+		want     string
+	}{
+		{
+			name:     "template over existing",
+			template: map[string]string{"a": "template"},
+			want:     "template",
+		},
+		{
+			name:     "template over label mapping",
+			template: map[string]string{"a": "template"},
+			opts:     MergeOptions{LabelMappings: mappings},
+			want:     "template",
+		},
+		{
+			name: "label mapping without template key",
+			opts: MergeOptions{LabelMappings: mappings},
+			want: "mapped",
+		},
+		{
+			name:     "file over template and label mapping",
+			template: map[string]string{"a": "template"},
+			opts: MergeOptions{LabelMappings: mappings, Annotations: map[string]map[string]string{
+				"default/app": {"a": "file"},
+			}},
+			want: "file",
+		},
+		{
+			name:     "file entries of other secrets are ignored",
+			template: map[string]string{"a": "template"},
+			opts: MergeOptions{Annotations: map[string]map[string]string{
+				"default/other": {"a": "file"},
+				"other/app":     {"a": "file"},
+			}},
+			want: "template",
+		},
+		{
+			name:     "file values are not rendered",
+			template: map[string]string{"a": "{{ .Secret.Name }}"},
+			opts: MergeOptions{Templating: true, Annotations: map[string]map[string]string{
+				"default/app": {"a": "{{ .Secret.Name }}"},
+			}},
+			want: "{{ .Secret.Name }}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := metaSecret("default", "app", tt.template, nil)
+			a, _, err := desiredMetadata(tmpl, target, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a["a"] != tt.want {
+				t.Errorf("annotation = %q, want %q", a["a"], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package secrettemplate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// revertValues returns merge patch values restoring the keys to their value in before,
+// with nil values deleting the keys before did not have
+func revertValues(before map[string]string, keys ...[]string) map[string]interface{} {
+	p := make(map[string]interface{})
+	for _, ks := range keys {
+		for _, k := range ks {
+			if v, ok := before[k]; ok {
+				p[k] = v
+			} else {
+				p[k] = nil
+			}
+		}
+	}
+	return p
+}
+
+// revertSecret merge patches the keys of the change back to their value in before
+func revertSecret(ctx context.Context, client kubernetes.Interface, before *corev1.Secret, change *Change, opts PatchOptions) error {
+	patchData := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": revertValues(before.Annotations, change.Annotations, change.RemoveAnnotations),
+			"labels":      revertValues(before.Labels, change.Labels, change.RemoveLabels),
+		},
+	}
+	if opts.IncludeData && len(change.Data) > 0 {
+		data := make(map[string]interface{}, len(change.Data))
+		for _, k := range change.Data {
+			if v, ok := before.Data[k]; ok {
+				data[k] = v
+			} else {
+				data[k] = nil
+			}
+		}
+		patchData["data"] = data
+	}
+	jd, err := json.Marshal(patchData)
+	if err != nil {
+		return err
+	}
+	_, err = client.CoreV1().Secrets(before.Namespace).Patch(ctx, before.Name, types.MergePatchType, jd, metav1.PatchOptions{FieldManager: opts.fieldManager()})
+	return ClassifyAPIError(err)
+}
+
+// patchTransactional patches the secret and verifies the change stuck, reverting the
+// secret to its pre-patch metadata if it did not. The returned error is the verification
+// failure, including the revert failure if the revert failed too.
+func patchTransactional(ctx context.Context, client kubernetes.Interface, secret *corev1.Secret, change *Change, opts PatchOptions) error {
+	l := log.WithFields(
+		log.Fields{
+			"action": "patchTransactional",
+			"secret": secret.Namespace + "/" + secret.Name,
+		},
+	)
+	before, err := client.CoreV1().Secrets(secret.Namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+	if err != nil {
+		return ClassifyAPIError(err)
+	}
+	if err := PatchSecretMetadata(ctx, client, secret, change, opts); err != nil {
+		return err
+	}
+	verr := VerifySecret(ctx, client, secret, change)
+	if verr == nil {
+		return nil
+	}
+	l.Warnf("reverting: %v", verr)
+	if rerr := revertSecret(ctx, client, before, change, opts); rerr != nil {
+		l.Errorf("revert failed: %v", rerr)
+		return fmt.Errorf("%v, revert failed: %w", verr, rerr)
+	}
+	return fmt.Errorf("%w, reverted", verr)
+}
@@ -0,0 +1,97 @@
+package secrettemplate
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// validateMetadata checks the annotations and labels applied to the target secret with
+// the API server's own validation. Invalid entries are an error when strict is set and
+// are otherwise logged and left out of the returned maps. Annotations exceeding the total
+// size limit are always an error, as no single entry is at fault.
+func validateMetadata(target *corev1.Secret, annotations map[string]string, labels map[string]string, strict bool) (map[string]string, map[string]string, error) {
+	l := log.WithFields(log.Fields{
+		"action": "validateMetadata",
+		"secret": target.Namespace + "/" + target.Name,
+	})
+	var errs field.ErrorList
+	a, ae := validEntries(annotations, func(k, v string) field.ErrorList {
+		return apivalidation.ValidateAnnotations(map[string]string{k: v}, field.NewPath("metadata", "annotations"))
+	})
+	lb, le := validEntries(labels, func(k, v string) field.ErrorList {
+		return metav1validation.ValidateLabels(map[string]string{k: v}, field.NewPath("metadata", "labels"))
+	})
+	errs = append(append(errs, ae...), le...)
+	if len(errs) > 0 {
+		if strict {
+			return nil, nil, fmt.Errorf("secret %s/%s has invalid metadata: %w", target.Namespace, target.Name, errs.ToAggregate())
+		}
+		for _, e := range errs {
+			l.Warnf("skipping invalid metadata: %v", e)
+		}
+	}
+	if err := apivalidation.ValidateAnnotationsSize(a); err != nil {
+		return nil, nil, fmt.Errorf("secret %s/%s: %w", target.Namespace, target.Name, err)
+	}
+	return a, lb, nil
+}
+
+// validEntries returns the entries of m for which validate reports no errors, and the
+// errors of the others. m is returned as is if every entry is valid.
+func validEntries(m map[string]string, validate func(k, v string) field.ErrorList) (map[string]string, field.ErrorList) {
+	var errs field.ErrorList
+	var invalid []string
+	for _, k := range SortedKeys(m) {
+		if ke := validate(k, m[k]); len(ke) > 0 {
+			errs = append(errs, ke...)
+			invalid = append(invalid, k)
+		}
+	}
+	if len(invalid) == 0 {
+		return m, nil
+	}
+	valid := make(map[string]string, len(m))
+	for k, v := range m {
+		valid[k] = v
+	}
+	for _, k := range invalid {
+		delete(valid, k)
+	}
+	return valid, errs
+}
+
+// annotationsSize returns the total size of the annotations as the API server counts it
+// against apivalidation.TotalAnnotationSizeLimitB
+func annotationsSize(annotations map[string]string) int {
+	size := 0
+	for k, v := range annotations {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// checkMergedSize reports whether the merged annotations of the target secret fit the
+// total size limit, logging a warning when they do not. With strict set the secret is
+// skipped rather than left for the API server to reject.
+func checkMergedSize(target *corev1.Secret, merged map[string]string, strict bool) bool {
+	size := annotationsSize(merged)
+	if size <= apivalidation.TotalAnnotationSizeLimitB {
+		return true
+	}
+	l := log.WithFields(log.Fields{
+		"action": "checkMergedSize",
+		"secret": target.Namespace + "/" + target.Name,
+		"size":   size,
+	})
+	if strict {
+		l.Warnf("skip secret %s/%s: merged annotations of %d bytes exceed the %d byte limit", target.Namespace, target.Name, size, apivalidation.TotalAnnotationSizeLimitB)
+		return false
+	}
+	l.Warnf("secret %s/%s merged annotations of %d bytes exceed the %d byte limit, the API server will reject the update", target.Namespace, target.Name, size, apivalidation.TotalAnnotationSizeLimitB)
+	return true
+}
@@ -0,0 +1,49 @@
+package secrettemplate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// unappliedKeys returns the changed keys whose value in actual differs from desired, and
+// the removed keys still present in actual
+func unappliedKeys(actual, desired map[string]string, changed, removed []string) []string {
+	var keys []string
+	for _, k := range changed {
+		if v, ok := actual[k]; !ok || v != desired[k] {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range removed {
+		if _, ok := actual[k]; ok {
+			keys = append(keys, "-"+k)
+		}
+	}
+	return keys
+}
+
+// VerifySecret reads the secret back after it was patched and returns an error naming the
+// changed annotations and labels which are not present, e.g. because an admission webhook
+// stripped or mutated them
+func VerifySecret(ctx context.Context, client kubernetes.Interface, secret *corev1.Secret, change *Change) error {
+	actual, err := client.CoreV1().Secrets(secret.Namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("verify: %w", ClassifyAPIError(err))
+	}
+	var missing []string
+	if keys := unappliedKeys(actual.Annotations, secret.Annotations, change.Annotations, change.RemoveAnnotations); len(keys) > 0 {
+		missing = append(missing, "annotations="+strings.Join(keys, ","))
+	}
+	if keys := unappliedKeys(actual.Labels, secret.Labels, change.Labels, change.RemoveLabels); len(keys) > 0 {
+		missing = append(missing, "labels="+strings.Join(keys, ","))
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("verify: keys did not stick: %s", strings.Join(missing, " "))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// namespaceCheck returns the --between-namespace-check hook running command with the
+// namespace just processed in the NAMESPACE environment variable. The check fails if the
+// command exits non-zero, with its output appended to the error.
+func namespaceCheck(command []string) func(ctx context.Context, namespace string) error {
+	return func(ctx context.Context, namespace string) error {
+		l := log.WithFields(log.Fields{
+			"action":    "namespaceCheck",
+			"command":   command[0],
+			"namespace": namespace,
+		})
+		l.Print("namespaceCheck")
+		var out bytes.Buffer
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Env = append(os.Environ(), "NAMESPACE="+namespace)
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(out.String()); msg != "" {
+				err = fmt.Errorf("%w: %s", err, msg)
+			}
+			return fmt.Errorf("%s: %w", command[0], err)
+		}
+		return nil
+	}
+}
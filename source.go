@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+)
+
+// sourceSchemes maps the URI scheme of a template source argument to the constructor of
+// its source, passed the rest of the URI
+var sourceSchemes = map[string]func(path string, cfg *config) secrettemplate.Source{
+	"file": func(path string, cfg *config) secrettemplate.Source {
+		return &secrettemplate.FileSource{Files: secrettemplate.GetSecretFiles(path), ResolveIncludes: cfg.EnableInclude}
+	},
+	"kustomize": func(path string, cfg *config) secrettemplate.Source {
+		return kustomizeSource{dir: path}
+	},
+}
+
+// openSource returns the source of a template source argument of the form scheme://path.
+// An argument without a scheme is a file or directory path.
+func openSource(uri string, cfg *config) (secrettemplate.Source, error) {
+	scheme, path := "file", uri
+	if i := strings.Index(uri, "://"); i >= 0 {
+		scheme, path = uri[:i], uri[i+len("://"):]
+	}
+	newSource, ok := sourceSchemes[scheme]
+	if !ok {
+		return nil, fmt.Errorf("unknown template source scheme %q in %q", scheme, uri)
+	}
+	return newSource(path, cfg), nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// statusConfigMapKey is the ConfigMap data key the run status is written to
+const statusConfigMapKey = "status.json"
+
+// runStatus is the document written to the status ConfigMap after each run
+type runStatus struct {
+	Time    time.Time               `json:"time"`
+	Summary *secrettemplate.Summary `json:"summary"`
+	Error   string                  `json:"error,omitempty"`
+}
+
+// splitNamespacedName splits a namespace/name reference
+func splitNamespacedName(ref string) (string, string, error) {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid reference %q, expected namespace/name", ref)
+	}
+	return parts[0], parts[1], nil
+}
+
+// writeStatusConfigMap upserts the ConfigMap referenced by ref with the run status
+func writeStatusConfigMap(ctx context.Context, ref string, summary *secrettemplate.Summary, runErr error) error {
+	l := log.WithFields(
+		log.Fields{
+			"action":    "writeStatusConfigMap",
+			"configmap": ref,
+		})
+	l.Print("writeStatusConfigMap")
+	ns, name, err := splitNamespacedName(ref)
+	if err != nil {
+		return err
+	}
+	st := runStatus{
+		Time:    time.Now().UTC(),
+		Summary: summary,
+	}
+	if runErr != nil {
+		st.Error = runErr.Error()
+	}
+	jd, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	cc := k8sClient.CoreV1().ConfigMaps(ns)
+	cm, err := cc.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		l.Print("create status configmap")
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+			},
+			Data: map[string]string{
+				statusConfigMapKey: string(jd),
+			},
+		}
+		_, err = cc.Create(ctx, cm, metav1.CreateOptions{FieldManager: secrettemplate.FieldManager})
+		return err
+	} else if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[statusConfigMapKey] = string(jd)
+	_, err = cc.Update(ctx, cm, metav1.UpdateOptions{FieldManager: secrettemplate.FieldManager})
+	return err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+)
+
+// exitChanges is the exit code of a --detailed-exitcode dry run which found changes
+const exitChanges = 2
+
+// exitTimeout is the exit code of a run which exceeded --run-timeout
+const exitTimeout = 3
+
+// writeChanged writes a line per patched or created secret to w, writing nothing if no
+// secret changed
+func writeChanged(w io.Writer, s *secrettemplate.Summary) error {
+	for _, r := range s.Results {
+		if r.Action != secrettemplate.ActionPatched && r.Action != secrettemplate.ActionCreated {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s %s/%s %s\n", r.Action, r.Namespace, r.Name, r.Change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summaryLine is the machine readable run summary printed by --summary-only
+type summaryLine struct {
+	*secrettemplate.Summary
+	DurationSeconds float64 `json:"durationSeconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// writeSummaryLine writes the run summary to w as a single line JSON object
+func writeSummaryLine(w io.Writer, s *secrettemplate.Summary, runErr error, d time.Duration) error {
+	sl := summaryLine{Summary: s, DurationSeconds: d.Seconds()}
+	if runErr != nil {
+		sl.Error = runErr.Error()
+	}
+	return json.NewEncoder(w).Encode(sl)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// loadTemplates parses the templates of the template sources. With --env, the templates
+// of the secrets directory's base/ directory are merged with those of overlays/<env>/.
+// With --kustomize, the templates are the Secrets rendered by the kustomization instead.
+// With --post-renderer, every source is post-rendered before it is parsed.
+func loadTemplates(cfg *config) ([]*corev1.Secret, error) {
+	opts := secrettemplate.ParseOptions{
+		ResolveIncludes: cfg.EnableInclude,
+		StrictDecode:    cfg.StrictDecode,
+	}
+	if cfg.Kustomize != "" {
+		return parseSource(kustomizeSource{dir: cfg.Kustomize}, cfg, opts)
+	}
+	if cfg.Env == "" {
+		paths := cfg.secretPaths
+		if len(paths) == 0 {
+			paths = []string{cfg.SecretsDir}
+		}
+		return loadPathTemplates(paths, cfg, opts)
+	}
+	base, err := parseSource(&secrettemplate.FileSource{
+		Files:           secrettemplate.GetSecretFiles(filepath.Join(cfg.SecretsDir, "base")),
+		ResolveIncludes: opts.ResolveIncludes,
+	}, cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(cfg.SecretsDir, "overlays", cfg.Env)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("--env %s: %w", cfg.Env, err)
+	}
+	overlay, err := parseSource(&secrettemplate.FileSource{
+		Files:           secrettemplate.GetSecretFiles(dir),
+		ResolveIncludes: opts.ResolveIncludes,
+	}, cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	return secrettemplate.MergeOverlay(base, overlay), nil
+}
+
+// loadPathTemplates parses the templates of each template source in turn. A file reached
+// through several paths is parsed only for the first of them, and templates of later
+// sources are merged into earlier ones with the same namespace and name as overlays are,
+// their keys taking precedence.
+func loadPathTemplates(paths []string, cfg *config, opts secrettemplate.ParseOptions) ([]*corev1.Secret, error) {
+	seen := make(map[string]bool)
+	var templates []*corev1.Secret
+	for i, p := range paths {
+		src, err := openSource(p, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if fs, ok := src.(*secrettemplate.FileSource); ok {
+			var files []string
+			for _, f := range fs.Files {
+				key := filepath.Clean(f)
+				if abs, err := filepath.Abs(f); err == nil {
+					key = abs
+				}
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				files = append(files, f)
+			}
+			fs.Files = files
+		}
+		ts, err := parseSource(src, cfg, opts)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			templates = ts
+			continue
+		}
+		templates = secrettemplate.MergeOverlay(templates, ts)
+	}
+	return templates, nil
+}
+
+// resolveTemplates loads the templates and resolves the secrets they apply to: the
+// namespaces directive is expanded and namespaces are remapped, discovered, defaulted and
+// replicated, name affixes are applied, and with --include-data copied data is read from
+// its source secrets
+func resolveTemplates(ctx context.Context, cfg *config) ([]*corev1.Secret, error) {
+	l := log.WithFields(log.Fields{
+		"action": "resolveTemplates",
+	})
+	sec, err := loadTemplates(cfg)
+	if err != nil {
+		return nil, err
+	}
+	l.Printf("parsed secrets: %d", len(sec))
+	if sec, err = secrettemplate.ExpandNamespaces(sec, cfg.EnableTemplating, cfg.values); err != nil {
+		return nil, err
+	}
+	secrettemplate.RemapNamespaces(sec, cfg.contextNamespaces[clusterContext])
+	if cfg.NameAllNamespaces {
+		if sec, err = expandAllNamespaces(ctx, sec); err != nil {
+			return nil, err
+		}
+	}
+	var scope []string
+	if cfg.NamespaceSource != namespaceSourceTemplates {
+		var filter namespaceFilter
+		if cfg.NamespaceSource == namespaceSourceSelector {
+			filter = namespaceFilter{
+				selector: cfg.NamespaceSelector,
+				regex:    cfg.NamespaceRegex,
+				or:       cfg.NamespaceMatch == namespaceMatchOr,
+			}
+		}
+		namespaces, err := discoverNamespaces(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		l.Printf("discovered namespaces: %d", len(namespaces))
+		sec = scopeTemplates(sec, namespaces, cfg.NamespaceSource == namespaceSourceSelector)
+		scope = namespaces
+	}
+	sec = applyDefaultNamespace(sec, resolveDefaultNamespace(cfg.DefaultNamespace))
+	if rns := cfg.replicateNamespaces(); len(rns) > 0 {
+		sec = secrettemplate.ReplicateNamespaces(sec, rns)
+		if cfg.NamespaceSource == namespaceSourceSelector {
+			// replicas are subject to the namespace selection like any template
+			sec = scopeTemplates(sec, scope, true)
+		}
+	}
+	secrettemplate.ApplyNameAffixes(sec, cfg.NamePrefix, cfg.NameSuffix)
+	if cfg.IncludeData {
+		if err := secrettemplate.CopySourceData(ctx, k8sClient, sec, cfg.CopyDataNamespaces); err != nil {
+			return nil, err
+		}
+	}
+	return sec, nil
+}
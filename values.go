@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	"sigs.k8s.io/yaml"
+)
+
+// loadValuesFiles reads the YAML values files, later files overriding earlier ones
+func loadValuesFiles(paths []string) (map[string]interface{}, error) {
+	var layers []map[string]interface{}
+	for _, p := range paths {
+		fd, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		var v map[string]interface{}
+		if err := yaml.Unmarshal(fd, &v); err != nil {
+			return nil, fmt.Errorf("values file %s: %w", p, err)
+		}
+		layers = append(layers, v)
+	}
+	return secrettemplate.MergeValues(layers...), nil
+}
+
+// loadAnnotationsFile reads a JSON file mapping namespace/name secret keys to the extra
+// annotations of that secret
+func loadAnnotationsFile(path string) (map[string]map[string]string, error) {
+	fd, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var annotations map[string]map[string]string
+	if err := json.Unmarshal(fd, &annotations); err != nil {
+		return nil, fmt.Errorf("annotations file %s: %w", path, err)
+	}
+	for k := range annotations {
+		if p := strings.SplitN(k, "/", 2); len(p) != 2 || p[0] == "" || p[1] == "" {
+			return nil, fmt.Errorf("annotations file %s: invalid key %q, expected namespace/name", path, k)
+		}
+	}
+	return annotations, nil
+}
+
+// loadLabelMappings reads a YAML list of label to annotation mappings
+func loadLabelMappings(path string) ([]secrettemplate.LabelMapping, error) {
+	fd, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mappings []secrettemplate.LabelMapping
+	if err := yaml.Unmarshal(fd, &mappings); err != nil {
+		return nil, fmt.Errorf("label mappings file %s: %w", path, err)
+	}
+	for i, m := range mappings {
+		if m.SourceLabel == "" || m.TargetAnnotation == "" {
+			return nil, fmt.Errorf("label mappings file %s: mapping %d requires sourceLabel and targetAnnotation", path, i)
+		}
+	}
+	return mappings, nil
+}
+
+// loadContextNamespaces reads a YAML file mapping kubeconfig context names to a mapping
+// of template namespaces to the namespaces they are translated to in that context
+func loadContextNamespaces(path string) (map[string]map[string]string, error) {
+	fd, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var namespaces map[string]map[string]string
+	if err := yaml.UnmarshalStrict(fd, &namespaces); err != nil {
+		return nil, fmt.Errorf("context namespace override file %s: %w", path, err)
+	}
+	for ctx, m := range namespaces {
+		for from, to := range m {
+			if from == "" || to == "" {
+				return nil, fmt.Errorf("context namespace override file %s: context %s maps %q to %q, expected two namespaces", path, ctx, from, to)
+			}
+		}
+	}
+	return namespaces, nil
+}
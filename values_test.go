@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadAnnotationsFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		want      map[string]map[string]string
+		wantError string
+	}{
+		{
+			name:    "annotations per secret",
+			content: `{"default/app": {"example.com/build": "1234"}, "other/db": {"a": "b"}}`,
+			want:    map[string]map[string]string{"default/app": {"example.com/build": "1234"}, "other/db": {"a": "b"}},
+		},
+		{name: "key without namespace", content: `{"app": {"a": "b"}}`, wantError: `invalid key "app"`},
+		{name: "key without name", content: `{"default/": {"a": "b"}}`, wantError: `invalid key "default/"`},
+		{name: "invalid json", content: `{"default/app": ["a"]}`, wantError: "annotations file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "annotations.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadAnnotationsFile(path)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("err = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("annotations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := loadAnnotationsFile(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("missing file err = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/umg/devops-k8s-secret-template-in-place/secrettemplate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// waitPollInterval is how often a missing secret is looked up with --wait-for-secret
+const waitPollInterval = 2 * time.Second
+
+// waitForSecrets polls, for up to timeout, for the target secrets of the name matched
+// templates which match no existing secret and are not ignored, returning the existing
+// secrets with those which appeared in the meantime appended
+func waitForSecrets(ctx context.Context, templates []*corev1.Secret, existing []corev1.Secret, ignored ignoreList, timeout time.Duration) ([]corev1.Secret, error) {
+	l := log.WithFields(log.Fields{
+		"action":  "waitForSecrets",
+		"timeout": timeout.String(),
+	})
+	var missing []*corev1.Secret
+	for _, t := range templates {
+		if secrettemplate.IsNameTemplate(t) && !ignored.ignored(t.Namespace, t.Name) &&
+			len(secrettemplate.MatchingSecrets(t, existing)) == 0 {
+			l.Printf("waiting for secret %s/%s", t.Namespace, t.Name)
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) == 0 {
+		return existing, nil
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		var still []*corev1.Secret
+		for _, t := range missing {
+			s, err := k8sClient.CoreV1().Secrets(t.Namespace).Get(ctx, t.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				still = append(still, t)
+				continue
+			} else if err != nil {
+				return existing, secrettemplate.ClassifyAPIError(err)
+			}
+			l.Printf("secret %s/%s appeared", t.Namespace, t.Name)
+			existing = append(existing, *s)
+		}
+		missing = still
+		if len(missing) == 0 {
+			return existing, nil
+		}
+		if !time.Now().Add(waitPollInterval).Before(deadline) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return existing, ctx.Err()
+		case <-time.After(waitPollInterval):
+		}
+	}
+	for _, t := range missing {
+		l.Warnf("gave up waiting for secret %s/%s", t.Namespace, t.Name)
+	}
+	return existing, nil
+}
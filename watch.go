@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// incrementalLister lists every secret of a namespace on the first reconcile and on each
+// full sync, and in between only the secrets changed since the last seen resourceVersion
+type incrementalLister struct {
+	fullSync time.Duration
+	lastFull time.Time
+	versions map[string]string
+}
+
+// newIncrementalLister returns an incrementalLister doing a full list every fullSync
+func newIncrementalLister(fullSync time.Duration) *incrementalLister {
+	return &incrementalLister{
+		fullSync: fullSync,
+		versions: map[string]string{},
+	}
+}
+
+// list returns the secrets to reconcile in each namespace, falling back to a full list
+// for namespaces without a resourceVersion or whose watch fails, e.g. once the
+// resourceVersion has expired. The listing is partial if any namespace was watched.
+func (il *incrementalLister) list(ctx context.Context, namespaces []string) ([]corev1.Secret, bool, error) {
+	l := log.WithFields(
+		log.Fields{
+			"action": "incrementalLister",
+		})
+	if il.fullSync > 0 && time.Since(il.lastFull) >= il.fullSync {
+		l.Print("full sync")
+		il.versions = map[string]string{}
+		il.lastFull = time.Now()
+	}
+	var secrets []corev1.Secret
+	partial := false
+	for _, ns := range namespaces {
+		if rv, ok := il.versions[ns]; ok {
+			changed, nrv, err := watchSecretsSince(ctx, ns, rv)
+			if err == nil {
+				l.Printf("namespace %s changed secrets: %d resourceVersion: %s", ns, len(changed), nrv)
+				il.versions[ns] = nrv
+				recordResourceVersion(ns, nrv)
+				secrets = append(secrets, changed...)
+				partial = true
+				continue
+			}
+			l.Warnf("namespace %s watch from resourceVersion %s failed, listing: %v", ns, rv, err)
+		}
+		sl, err := k8sClient.CoreV1().Secrets(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			delete(il.versions, ns)
+			return nil, false, err
+		}
+		l.Printf("namespace %s secrets: %d resourceVersion: %s", ns, len(sl.Items), sl.ResourceVersion)
+		il.versions[ns] = sl.ResourceVersion
+		recordResourceVersion(ns, sl.ResourceVersion)
+		secrets = append(secrets, sl.Items...)
+	}
+	return secrets, partial, nil
+}
+
+// watchSecretsSince returns the secrets in ns added or modified after resourceVersion rv,
+// along with the latest resourceVersion seen
+func watchSecretsSince(ctx context.Context, ns string, rv string) ([]corev1.Secret, string, error) {
+	timeout := int64(1)
+	w, err := k8sClient.CoreV1().Secrets(ns).Watch(ctx, metav1.ListOptions{
+		ResourceVersion:     rv,
+		TimeoutSeconds:      &timeout,
+		AllowWatchBookmarks: true,
+	})
+	if err != nil {
+		return nil, rv, err
+	}
+	defer w.Stop()
+	changed := map[string]corev1.Secret{}
+	for ev := range w.ResultChan() {
+		switch ev.Type {
+		case watch.Error:
+			return nil, rv, apierrors.FromObject(ev.Object)
+		case watch.Added, watch.Modified, watch.Deleted, watch.Bookmark:
+			s, ok := ev.Object.(*corev1.Secret)
+			if !ok {
+				return nil, rv, fmt.Errorf("unexpected watch object type: %T", ev.Object)
+			}
+			rv = s.ResourceVersion
+			switch ev.Type {
+			case watch.Added, watch.Modified:
+				changed[s.Name] = *s
+			case watch.Deleted:
+				delete(changed, s.Name)
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, rv, err
+	}
+	var secrets []corev1.Secret
+	for _, s := range changed {
+		secrets = append(secrets, s)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Name < secrets[j].Name
+	})
+	return secrets, rv, nil
+}